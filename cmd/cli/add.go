@@ -2,8 +2,8 @@ package cli
 
 import (
 	"fmt"
+	"path/filepath"
 
-	"github.com/aryandutt/gvc/internal/core"
 	"github.com/spf13/cobra"
 )
 
@@ -16,8 +16,18 @@ var addCmd = &cobra.Command{
 	Short: "Add files to the staging area",
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
 		for _, file := range args {
-			if err := core.AddToStage(file); err != nil {
+			// Paths on the command line are relative to the current directory
+			path, err := filepath.Abs(file)
+			if err == nil {
+				err = repo.Add(path)
+			}
+			if err != nil {
 				fmt.Printf("Error adding %s: %v\n", file, err)
 			} else {
 				fmt.Printf("Added %s\n", file)
@@ -3,7 +3,7 @@ package cli
 import (
 	"fmt"
 
-	"github.com/aryandutt/gvc/internal/core"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
@@ -16,8 +16,32 @@ var branchCmd = &cobra.Command{
 	Short: "List all branches",
 	Args:  cobra.MinimumNArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
-		if err:= core.ListBranch(); err != nil {
+		repo, err := openRepo()
+		if err != nil {
 			fmt.Println("Error:", err)
+			return
+		}
+		branches, err := repo.Branches()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		head, err := repo.Head()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		// color the current branch green
+		green := color.New(color.FgGreen).SprintFunc()
+		if head.Detached() {
+			fmt.Printf("%s *\n", green(fmt.Sprintf("(HEAD detached at %s)", head.Commit[:7])))
+		}
+		for _, branch := range branches {
+			if branch.Current {
+				fmt.Printf("%s *\n", green(branch.Name))
+				continue
+			}
+			fmt.Println(branch.Name)
 		}
 	},
 }
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var checkIgnoreVerbose bool
+
+func init() {
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreVerbose, "verbose", "v", false, "Show the pattern that matched each path")
+	rootCmd.AddCommand(checkIgnoreCmd)
+}
+
+var checkIgnoreCmd = &cobra.Command{
+	Use:   "check-ignore [path]",
+	Short: "Show which paths are ignored by .gvcignore and exclude files",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		anyIgnored := false
+		for _, file := range args {
+			// Paths on the command line are relative to the current directory
+			path, err := filepath.Abs(file)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			match, err := repo.CheckIgnore(path)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if match == nil || match.Negated {
+				continue
+			}
+			anyIgnored = true
+			if checkIgnoreVerbose {
+				fmt.Printf("%s:%d:%s\t%s\n", match.Source, match.Line, match.Pattern, file)
+			} else {
+				fmt.Println(file)
+			}
+		}
+		// Like git, exit with 1 when no path is ignored so scripts can test it
+		if !anyIgnored {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(checkoutCmd)
+}
+
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout [branch or commit]",
+	Short: "Switch to a branch, or check out a commit or tag with a detached HEAD",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			log.Fatalf("failed to open repository: %v", err)
+		}
+		branches, err := repo.Branches()
+		if err != nil {
+			log.Fatalf("failed to list branches: %v", err)
+		}
+		isBranch := false
+		for _, branch := range branches {
+			isBranch = isBranch || branch.Name == args[0]
+		}
+
+		left, err := repo.Switch(args[0], gvc.SwitchOptions{Detach: !isBranch})
+		if err != nil {
+			log.Fatalf("failed to check out %s: %v", args[0], err)
+		}
+		warnLeftBehind(left)
+		if isBranch {
+			fmt.Printf("Switched to branch %s\n", args[0])
+			return
+		}
+		printDetachedHead(repo)
+	},
+}
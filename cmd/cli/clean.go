@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cleanOptions gvc.CleanOptions
+	cleanForce   bool
+)
+
+func init() {
+	cleanCmd.Flags().BoolVarP(&cleanOptions.DryRun, "dry-run", "n", false, "List the files that would be removed without removing them")
+	cleanCmd.Flags().BoolVarP(&cleanForce, "force", "f", false, "Remove the files")
+	cleanCmd.Flags().BoolVarP(&cleanOptions.Ignored, "ignored", "x", false, "Also remove files matching .gvcignore patterns")
+	rootCmd.AddCommand(cleanCmd)
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove untracked files from the working directory",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cleanForce && !cleanOptions.DryRun {
+			fmt.Println("Error: refusing to clean without -f or -n")
+			return
+		}
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		removed, err := repo.Clean(cleanOptions)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		for _, path := range removed {
+			if cleanOptions.DryRun {
+				fmt.Printf("Would remove %s\n", path)
+			} else {
+				fmt.Printf("Removing %s\n", path)
+			}
+		}
+	},
+}
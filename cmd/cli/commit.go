@@ -1,10 +1,11 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os/user"
 
-	"github.com/aryandutt/gvc/internal/core"
+	"github.com/aryandutt/gvc/pkg/gvc"
 	"github.com/spf13/cobra"
 )
 
@@ -26,34 +27,23 @@ var commitCmd = &cobra.Command{
 			return
 		}
 
-		user, err := user.Current()
-
+		repo, err := openRepo()
 		if err != nil {
-			fmt.Println("Error getting user info:", err)
+			fmt.Println("Error:", err)
 			return
 		}
 
-		isFirstCommit, err := core.IsFirstCommit()
+		user, err := user.Current()
 
 		if err != nil {
-			fmt.Println("Error:", err)
+			fmt.Println("Error getting user info:", err)
 			return
 		}
 
-		if !isFirstCommit {
-			ok, err := core.CompareHeadAndIndex()
-			if err != nil {
-				fmt.Println("Error:", err)
-				return
-			}
-			if ok {
-				fmt.Println("Nothing to commit, working tree clean")
-				return
-			}
-		}
-
-		commitHash, err := core.CreateCommit(message, user.Username)
-		if err != nil {
+		commitHash, err := repo.Commit(message, user.Username)
+		if errors.Is(err, gvc.ErrNothingToCommit) {
+			fmt.Println("Nothing to commit, working tree clean")
+		} else if err != nil {
 			fmt.Println("Error:", err)
 		} else {
 			fmt.Printf("Committed: %s\n", commitHash[:7])
@@ -2,8 +2,10 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
-	"github.com/aryandutt/gvc/internal/core"
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
@@ -12,11 +14,77 @@ func init() {
   }
   
   var diffCmd = &cobra.Command{
-	Use:   "diff",
-	Short: "Shows the difference between the working directory and the staging area",
+	Use:   "diff [revision] [revision]",
+	Short: "Shows the difference between the working directory and the staging area, a commit, or two commits",
+	Long: `Without arguments, shows the changes in the working directory that are not staged.
+With one revision, shows the changes in the working directory since that commit.
+With two revisions, or a range a..b, shows the changes between them; a...b shows
+the changes on b since the last commit it shares with a.`,
+	Args: cobra.MaximumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := core.Diff(); err != nil {
+		repo, err := openRepo()
+		if err != nil {
 			fmt.Println("Error:", err)
+			return
 		}
+		var diffs []gvc.FileDiff
+		switch len(args) {
+		case 0:
+			diffs, err = repo.Diff()
+		case 1:
+			if rng, ok := gvc.ParseRange(args[0]); ok {
+				diffs, err = repo.DiffRange(rng)
+			} else {
+				diffs, err = repo.DiffWorkTree(args[0])
+			}
+		case 2:
+			diffs, err = repo.DiffRevisions(args[0], args[1])
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		printDiffs(diffs)
 	},
-  }
\ No newline at end of file
+  }
+
+// printDiffs prints the diffs with colored patches.
+func printDiffs(diffs []gvc.FileDiff) {
+	for _, diff := range diffs {
+		if diff.Status != "modified" {
+			fmt.Printf("%s: %s\n", diff.Status, diff.Path)
+			if diff.Patch != "" {
+				fmt.Print(colorizeDiff(diff.Patch))
+			}
+			continue
+		}
+		if diff.OldMode != "" {
+			fmt.Printf("diff --git a/%s b/%s\nold mode %s\nnew mode %s\n", diff.Path, diff.Path, diff.OldMode, diff.NewMode)
+		}
+		fmt.Print(colorizeDiff(diff.Patch))
+	}
+}
+
+func colorizeDiff(diffText string) string {
+	var sb strings.Builder
+	red := color.New(color.FgRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+
+	lines := strings.Split(diffText, "\n")
+	for _, line := range lines {
+		// Do not colorize diff headers.
+		if strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") {
+			sb.WriteString(line + "\n")
+		} else if strings.HasPrefix(line, "@@"){
+			sb.WriteString(blue(line) + "\n")
+		} else if strings.HasPrefix(line, "-") {
+			sb.WriteString(red(line) + "\n")
+		} else if strings.HasPrefix(line, "+") {
+			sb.WriteString(green(line) + "\n")
+		} else {
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
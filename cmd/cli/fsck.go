@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/spf13/cobra"
+)
+
+var fsckNoDangling bool
+
+func init() {
+	fsckCmd.Flags().BoolVar(&fsckNoDangling, "no-dangling", false, "Do not report dangling objects")
+	rootCmd.AddCommand(fsckCmd)
+}
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Verify the integrity of objects and refs",
+	Long:  "Verify the integrity of objects and refs. Exits with status 1 if any object or ref is corrupt or missing.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		report, err := repo.Fsck()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for _, problem := range report.Problems {
+			if fsckNoDangling && problem.Kind == gvc.FsckDangling {
+				continue
+			}
+			fmt.Println(problem)
+		}
+		if report.HasErrors() {
+			fmt.Printf("Checked %d objects: repository is corrupt\n", report.Objects)
+			os.Exit(1)
+		}
+		fmt.Printf("Checked %d objects: ok\n", report.Objects)
+	},
+}
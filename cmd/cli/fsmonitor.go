@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/spf13/cobra"
+)
+
+var fsmonitorIdle = gvc.DefaultFSMonitorIdle
+
+func init() {
+	fsmonitorRunCmd.Flags().DurationVar(&fsmonitorIdle, "idle", gvc.DefaultFSMonitorIdle, "Exit after not being queried for this long")
+	fsmonitorCmd.AddCommand(fsmonitorStartCmd, fsmonitorStopCmd, fsmonitorStatusCmd, fsmonitorRunCmd)
+	rootCmd.AddCommand(fsmonitorCmd)
+}
+
+var fsmonitorCmd = &cobra.Command{
+	Use:   "fsmonitor",
+	Short: "Watch the working directory so status only looks at changed files",
+}
+
+var fsmonitorStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the file system monitor in the background",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := repo.StartFSMonitor(); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("fsmonitor is running")
+	},
+}
+
+var fsmonitorStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the file system monitor",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := repo.StopFSMonitor(); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println("fsmonitor stopped")
+	},
+}
+
+var fsmonitorStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report whether the file system monitor is running",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if repo.FSMonitorRunning() {
+			fmt.Println("fsmonitor is running")
+		} else {
+			fmt.Println("fsmonitor is not running")
+		}
+	},
+}
+
+var fsmonitorRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the file system monitor in the foreground",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if err := repo.RunFSMonitor(fsmonitorIdle); err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Pack reachable objects into a delta-compressed pack file",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		result, err := repo.GC()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if result.Pack == "" {
+			fmt.Println("Nothing to pack")
+			return
+		}
+		fmt.Printf("Packed %d objects (%d deltas) into %s\n", result.Objects, result.Deltas, result.Pack)
+		fmt.Printf("Removed %d loose objects and %d old packs\n", result.LooseRemoved, result.PacksRemoved)
+	},
+}
@@ -2,12 +2,16 @@ package cli
 
 import (
 	"fmt"
+	"path/filepath"
 
-	"github.com/aryandutt/gvc/internal/core"
+	"github.com/aryandutt/gvc/pkg/gvc"
 	"github.com/spf13/cobra"
 )
 
+var initObjectFormat string
+
 func init() {
+	initCmd.Flags().StringVar(&initObjectFormat, "object-format", "sha1", "Hash algorithm for objects (sha1 or sha256)")
 	rootCmd.AddCommand(initCmd)
   }
   
@@ -15,10 +19,19 @@ func init() {
 	Use:   "init",
 	Short: "Initialize a new gvc repository",
 	Run: func(cmd *cobra.Command, args []string) {
-	  if err := core.InitRepo(); err != nil {
+	  dir := "."
+	  if gvcDir != "" {
+		dir = filepath.Dir(gvcDir)
+	  }
+	  format, err := gvc.LookupObjectFormat(initObjectFormat)
+	  if err != nil {
+		fmt.Println("Error:", err)
+		return
+	  }
+	  if _, err := gvc.Init(dir, gvc.WithObjectFormat(format)); err != nil {
 		fmt.Println("Error:", err)
 	  } else {
 		fmt.Println("Initialized gvc repository")
 	  }
 	},
-  }
\ No newline at end of file
+  }
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var lfsPruneDryRun bool
+
+func init() {
+	lfsPruneCmd.Flags().BoolVarP(&lfsPruneDryRun, "dry-run", "n", false, "List the files that would be removed without removing them")
+	lfsCmd.AddCommand(lfsTrackCmd, lfsLsFilesCmd, lfsPruneCmd)
+	rootCmd.AddCommand(lfsCmd)
+}
+
+var lfsCmd = &cobra.Command{
+	Use:   "lfs",
+	Short: "Store large files outside the object database",
+}
+
+var lfsTrackCmd = &cobra.Command{
+	Use:   "track [pattern...]",
+	Short: "Store files matching the patterns in the large file store",
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if len(args) == 0 {
+			patterns, err := repo.LFSPatterns()
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println("Listing tracked patterns")
+			for _, pattern := range patterns {
+				fmt.Printf("    %s (.gvcattributes)\n", pattern)
+			}
+			return
+		}
+		added, err := repo.LFSTrack(args...)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		isNew := make(map[string]bool, len(added))
+		for _, pattern := range added {
+			isNew[pattern] = true
+		}
+		for _, pattern := range args {
+			if isNew[pattern] {
+				fmt.Printf("Tracking %q\n", pattern)
+			} else {
+				fmt.Printf("%q already supported\n", pattern)
+			}
+		}
+	},
+}
+
+var lfsLsFilesCmd = &cobra.Command{
+	Use:   "ls-files",
+	Short: "List staged files stored in the large file store",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		files, err := repo.LFSFiles()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		for _, file := range files {
+			// "*" marks content present locally, "-" a pointer without content
+			marker := "-"
+			if file.Present {
+				marker = "*"
+			}
+			fmt.Printf("%s %s %s\n", file.Pointer.OID[:10], marker, file.Path)
+		}
+	},
+}
+
+var lfsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete large files that no commit or index entry refers to",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		pruned, err := repo.LFSPrune(lfsPruneDryRun)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		for _, object := range pruned {
+			fmt.Printf("%s %d\n", object.OID, object.Size)
+		}
+		if !lfsPruneDryRun {
+			fmt.Printf("Pruned %d files\n", len(pruned))
+		}
+	},
+}
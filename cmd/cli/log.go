@@ -3,7 +3,7 @@ package cli
 import (
 	"fmt"
 
-	"github.com/aryandutt/gvc/internal/core"
+	"github.com/aryandutt/gvc/pkg/gvc"
 	"github.com/fatih/color" // Optional: for colored output
 	"github.com/spf13/cobra"
 )
@@ -13,10 +13,23 @@ func init() {
 }
 
 var logCmd = &cobra.Command{
-	Use:   "log",
-	Short: "Display commit history",
+	Use:   "log [revision or range]",
+	Short: "Display commit history, of HEAD, a revision, or a range such as main..topic",
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		commits, err := core.LogCommits()
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		var commits []*gvc.Commit
+		if len(args) == 0 {
+			commits, err = repo.Log()
+		} else if rng, ok := gvc.ParseRange(args[0]); ok {
+			commits, err = repo.LogRange(rng)
+		} else {
+			commits, err = repo.LogFrom(args[0])
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 			return
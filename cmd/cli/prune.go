@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneExpire string
+	pruneDryRun bool
+)
+
+func init() {
+	pruneCmd.Flags().StringVar(&pruneExpire, "expire", "", "Only prune objects older than this (default gc.pruneExpire or 2.weeks.ago)")
+	pruneCmd.Flags().BoolVarP(&pruneDryRun, "dry-run", "n", false, "List the objects that would be removed without removing them")
+	rootCmd.AddCommand(pruneCmd)
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove unreachable loose objects",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		pruned, err := repo.Prune(pruneExpire, pruneDryRun)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		for _, object := range pruned {
+			fmt.Printf("%s %s\n", object.Hash, object.Type)
+		}
+		if !pruneDryRun {
+			fmt.Printf("Pruned %d objects\n", len(pruned))
+		}
+	},
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(reflogCmd)
+}
+
+var reflogCmd = &cobra.Command{
+	Use:   "reflog [ref]",
+	Short: "Show the changes of HEAD or a branch, which revisions such as HEAD@{2} refer to",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		name := "HEAD"
+		if len(args) == 1 {
+			name = args[0]
+		}
+		entries, err := repo.Reflog(name)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		yellow := color.New(color.FgYellow).SprintFunc()
+		for i, entry := range entries {
+			fmt.Printf("%s %s@{%d}: %s\n", yellow(entry.New[:7]), name, i, entry.Message)
+		}
+	},
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resetSoft  bool
+	resetMixed bool
+	resetHard  bool
+)
+
+func init() {
+	resetCmd.Flags().BoolVar(&resetSoft, "soft", false, "Only move the branch, keep the index and working directory")
+	resetCmd.Flags().BoolVar(&resetMixed, "mixed", false, "Also reset the index, keep the working directory (default)")
+	resetCmd.Flags().BoolVar(&resetHard, "hard", false, "Also reset the index and working directory, discarding local changes")
+	rootCmd.AddCommand(resetCmd)
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset [--soft | --mixed | --hard] [revision]",
+	Short: "Point the current branch at a commit such as HEAD~1, resetting the index and with --hard the working directory",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mode := gvc.ResetMixed
+		switch {
+		case resetSoft && (resetMixed || resetHard), resetMixed && resetHard:
+			fmt.Println("Error: --soft, --mixed and --hard cannot be used together")
+			return
+		case resetSoft:
+			mode = gvc.ResetSoft
+		case resetHard:
+			mode = gvc.ResetHard
+		}
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		rev := "HEAD"
+		if len(args) == 1 {
+			rev = args[0]
+		}
+		hash, err := repo.Reset(rev, mode)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if mode == gvc.ResetHard {
+			commit, err := repo.ReadCommit(hash)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			subject, _, _ := strings.Cut(commit.Message, "\n")
+			fmt.Printf("HEAD is now at %s %s\n", hash[:7], subject)
+		}
+	},
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/spf13/cobra"
+)
+
+var rmOptions gvc.RemoveOptions
+
+func init() {
+	rmCmd.Flags().BoolVar(&rmOptions.Cached, "cached", false, "Only remove from the staging area, keep the working tree file")
+	rmCmd.Flags().BoolVarP(&rmOptions.Recursive, "recursive", "r", false, "Allow recursive removal when a directory is given")
+	rmCmd.Flags().BoolVarP(&rmOptions.Force, "force", "f", false, "Remove files even if they have local modifications")
+	rootCmd.AddCommand(rmCmd)
+}
+
+var rmCmd = &cobra.Command{
+	Use:   "rm [file]",
+	Short: "Remove files from the working tree and the staging area",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		for _, file := range args {
+			// Paths on the command line are relative to the current directory
+			path, err := filepath.Abs(file)
+			var removed []string
+			if err == nil {
+				removed, err = repo.Remove(rmOptions, path)
+			}
+			if err != nil {
+				fmt.Printf("Error removing %s: %v\n", file, err)
+				continue
+			}
+			for _, path := range removed {
+				fmt.Printf("rm '%s'\n", path)
+			}
+		}
+	},
+}
@@ -1,17 +1,46 @@
 package cli
 
 import (
+  "os"
+
+  "github.com/aryandutt/gvc/pkg/gvc"
   "github.com/spf13/cobra"
 )
 
+var (
+  chdir  string
+  gvcDir string
+)
+
 var rootCmd = &cobra.Command{
   Use:   "gvc",
   Short: "A simple version control system written in Go",
   Long:  `GVC (Go Version Control) is a minimalist VCS for learning purposes.`,
+  PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+    // Like git -C, run as if gvc was started in the given directory
+    if chdir != "" {
+      return os.Chdir(chdir)
+    }
+    return nil
+  },
+}
+
+func init() {
+  rootCmd.PersistentFlags().StringVarP(&chdir, "chdir", "C", "", "Run as if gvc was started in this directory")
+  rootCmd.PersistentFlags().StringVar(&gvcDir, "gvc-dir", "", "Path to the .gvc directory (work tree is its parent)")
+}
+
+// openRepo locates the repository for the current command, either from
+// --gvc-dir or by walking up from the current directory.
+func openRepo() (*gvc.Repository, error) {
+  if gvcDir != "" {
+    return gvc.OpenGvcDir(gvcDir)
+  }
+  return gvc.Open(".")
 }
 
 func Execute() {
   if err := rootCmd.Execute(); err != nil {
     panic(err)
   }
-}
\ No newline at end of file
+}
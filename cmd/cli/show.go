@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(showCmd)
+}
+
+var showCmd = &cobra.Command{
+	Use:   "show [revision]",
+	Short: "Show a commit and its changes, a tag, a tree, or a file at a revision such as HEAD~1:main.go",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		rev := "HEAD"
+		if len(args) == 1 {
+			rev = args[0]
+		}
+		hash, typ, err := repo.ResolveRevision(rev)
+		if err == nil {
+			err = showObject(repo, rev, hash, typ)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+	},
+}
+
+// showObject prints the object rev names: a commit with its diff, a tag
+// followed by what it tags, the names in a tree, or a file's content.
+func showObject(repo *gvc.Repository, rev, hash, typ string) error {
+	yellow := color.New(color.FgYellow).SprintFunc()
+	switch typ {
+	case "commit":
+		commit, err := repo.ReadCommit(hash)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(
+			"%s\nAuthor: %s\nDate:   %s\n\n    %s\n\n",
+			yellow("commit "+commit.Hash),
+			commit.Author,
+			commit.Date.Format("Mon Jan 2 15:04:05 2006 -0700"),
+			commit.Message,
+		)
+		diffs, err := repo.DiffRevisions(commit.Parent, commit.Hash)
+		if err != nil {
+			return err
+		}
+		printDiffs(diffs)
+	case "tag":
+		tag, err := repo.ReadTag(hash)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(
+			"%s\nTagger: %s\nDate:   %s\n\n%s\n\n",
+			yellow("tag "+tag.Name),
+			tag.Tagger,
+			tag.Date.Format("Mon Jan 2 15:04:05 2006 -0700"),
+			strings.TrimRight(tag.Message, "\n"),
+		)
+		return showObject(repo, tag.Object, tag.Object, tag.Type)
+	case "tree":
+		entries, err := repo.ReadTree(hash)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n\n", yellow("tree "+rev))
+		for _, entry := range entries {
+			if entry.Type == "tree" {
+				fmt.Println(entry.Path + "/")
+			} else {
+				fmt.Println(entry.Path)
+			}
+		}
+	default:
+		data, err := repo.ReadBlob(hash)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+	}
+	return nil
+}
@@ -2,12 +2,24 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
-	"github.com/aryandutt/gvc/internal/core"
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
+var (
+	statusShort     bool
+	statusBranch    bool
+	statusPorcelain string
+)
+
 func init() {
+	statusCmd.Flags().BoolVarP(&statusShort, "short", "s", false, "Give the output in the short format")
+	statusCmd.Flags().BoolVarP(&statusBranch, "branch", "b", false, "Show branch information in short and porcelain formats")
+	statusCmd.Flags().StringVar(&statusPorcelain, "porcelain", "", "Give the output in a stable, machine-readable format (v1 or v2)")
+	statusCmd.Flags().Lookup("porcelain").NoOptDefVal = "v1"
 	rootCmd.AddCommand(statusCmd)
 }
 
@@ -15,8 +27,180 @@ var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Shows status of the repository",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := core.Status(); err != nil {
+		repo, err := openRepo()
+		if err != nil {
 			fmt.Println("Error:", err)
+			return
 		}
+		status, err := repo.Status()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		switch statusPorcelain {
+		case "":
+		case "1", "v1":
+			printShortStatus(status, statusBranch, false)
+			return
+		case "2", "v2":
+			printPorcelainV2(status, statusBranch, repo.ObjectFormat())
+			return
+		default:
+			fmt.Printf("Error: unsupported porcelain format %q\n", statusPorcelain)
+			return
+		}
+		if statusShort {
+			printShortStatus(status, statusBranch, true)
+			return
+		}
+		printLongStatus(status)
 	},
 }
+
+func printLongStatus(status *gvc.Status) {
+	if status.Branch == "" {
+		fmt.Printf("HEAD detached at %s\n", status.Head[:7])
+	} else {
+		fmt.Printf("On branch %s\n", status.Branch)
+	}
+	if status.Upstream != "" {
+		switch {
+		case status.Ahead > 0 && status.Behind > 0:
+			fmt.Printf("Your branch and '%s' have diverged,\nand have %d and %d different commits each, respectively.\n",
+				status.Upstream, status.Ahead, status.Behind)
+		case status.Ahead > 0:
+			fmt.Printf("Your branch is ahead of '%s' by %d commit(s).\n", status.Upstream, status.Ahead)
+		case status.Behind > 0:
+			fmt.Printf("Your branch is behind '%s' by %d commit(s).\n", status.Upstream, status.Behind)
+		default:
+			fmt.Printf("Your branch is up to date with '%s'.\n", status.Upstream)
+		}
+	}
+
+	green := color.New(color.FgHiGreen).SprintFunc()
+	var staged []string
+	for _, change := range []gvc.ChangeType{gvc.Added, gvc.Modified, gvc.Deleted} {
+		for _, path := range status.StagedPaths(change) {
+			staged = append(staged, fmt.Sprintf("%s: %s", change, path))
+		}
+	}
+	if len(staged) > 0 {
+		fmt.Println("\nChanges to be committed:")
+		for _, change := range staged {
+			fmt.Printf("\t%s\n", green(change))
+		}
+	}
+
+	red := color.New(color.FgHiRed).SprintFunc()
+	modifiedFiles := status.UnstagedPaths(gvc.Modified)
+	deletedFiles := status.UnstagedPaths(gvc.Deleted)
+	if len(modifiedFiles) > 0 || len(deletedFiles) > 0 {
+		fmt.Println("\nChanges not staged for commit:")
+		for _, path := range modifiedFiles {
+			fmt.Printf("\t%s: %s\n", red("modified"), red(path))
+		}
+		for _, path := range deletedFiles {
+			fmt.Printf("\t%s: %s\n", red("deleted"), red(path))
+		}
+	}
+
+	untrackedFiles := status.UntrackedPaths()
+	if len(untrackedFiles) > 0 {
+		fmt.Println("\nUntracked files:")
+		for _, path := range untrackedFiles {
+			fmt.Printf("\t%s: %s\n", red("untracked"), red(path))
+		}
+	}
+
+	if status.IsClean() {
+		fmt.Println("nothing to commit, working tree clean")
+	}
+}
+
+// printShortStatus prints "XY path" lines, as in git status --short and
+// --porcelain=v1. Colors are only used for --short.
+func printShortStatus(status *gvc.Status, branch, colored bool) {
+	green := fmt.Sprint
+	red := fmt.Sprint
+	if colored {
+		green = color.New(color.FgGreen).Sprint
+		red = color.New(color.FgRed).Sprint
+	}
+	if branch {
+		header := "## " + status.Branch
+		if status.Head == "" {
+			header = "## No commits yet on " + status.Branch
+		} else if status.Branch == "" {
+			header = "## HEAD (no branch)"
+		}
+		if status.Upstream != "" {
+			header += "..." + status.Upstream
+			var ab []string
+			if status.Ahead > 0 {
+				ab = append(ab, fmt.Sprintf("ahead %d", status.Ahead))
+			}
+			if status.Behind > 0 {
+				ab = append(ab, fmt.Sprintf("behind %d", status.Behind))
+			}
+			if len(ab) > 0 {
+				header += " [" + strings.Join(ab, ", ") + "]"
+			}
+		}
+		fmt.Println(header)
+	}
+	for _, entry := range status.Entries {
+		if entry.Staged == gvc.Untracked {
+			fmt.Printf("%s %s\n", red("??"), entry.Path)
+			continue
+		}
+		fmt.Printf("%s%s %s\n", green(shortCode(entry.Staged)), red(shortCode(entry.Unstaged)), entry.Path)
+	}
+}
+
+// printPorcelainV2 prints the format of git status --porcelain=v2.
+func printPorcelainV2(status *gvc.Status, branch bool, format *gvc.ObjectFormat) {
+	if branch {
+		oid := status.Head
+		if oid == "" {
+			oid = "(initial)"
+		}
+		fmt.Printf("# branch.oid %s\n", oid)
+		if status.Branch == "" {
+			fmt.Println("# branch.head (detached)")
+		} else {
+			fmt.Printf("# branch.head %s\n", status.Branch)
+		}
+		if status.Upstream != "" {
+			fmt.Printf("# branch.upstream %s\n", status.Upstream)
+			fmt.Printf("# branch.ab +%d -%d\n", status.Ahead, status.Behind)
+		}
+	}
+	const zeroMode = "000000"
+	zeroHash := strings.Repeat("0", format.HexSize())
+	orZero := func(value, zero string) string {
+		if value == "" {
+			return zero
+		}
+		return value
+	}
+	for _, entry := range status.Entries {
+		if entry.Staged == gvc.Untracked {
+			fmt.Printf("? %s\n", entry.Path)
+			continue
+		}
+		fmt.Printf("1 %c%c N... %s %s %s %s %s %s\n",
+			entry.Staged, entry.Unstaged,
+			orZero(entry.HeadMode, zeroMode), orZero(entry.IndexMode, zeroMode), orZero(entry.WorktreeMode, zeroMode),
+			orZero(entry.HeadHash, zeroHash), orZero(entry.IndexHash, zeroHash),
+			entry.Path)
+	}
+}
+
+// Helper: Short format uses a space where porcelain v2 uses '.'
+func shortCode(change gvc.ChangeType) string {
+	if change == gvc.Unmodified {
+		return " "
+	}
+	return string(change)
+}
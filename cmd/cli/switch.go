@@ -3,29 +3,98 @@ package cli
 import (
 	"fmt"
 	"log"
+	"strings"
 
-	"github.com/aryandutt/gvc/internal/core"
+	"github.com/aryandutt/gvc/pkg/gvc"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	switchCmd.Flags().BoolP("create", "c", false, "Create branch if it does not exist")
+	switchCmd.Flags().Bool("detach", false, "Check out a commit, tag or other revision without switching to a branch")
+	switchCmd.Flags().Bool("continue", false, "Finish a switch that was interrupted")
+	switchCmd.Flags().Bool("abort", false, "Undo a switch that was interrupted")
 	rootCmd.AddCommand(switchCmd)
 }
 
 var switchCmd = &cobra.Command{
 	Use:   "switch [branch name]",
 	Short: "Switch to a branch. Use -c flag to create the branch if it doesn't exist",
-	Args:  cobra.MinimumNArgs(1),
+	Args: func(cmd *cobra.Command, args []string) error {
+		continueFlag, _ := cmd.Flags().GetBool("continue")
+		abortFlag, _ := cmd.Flags().GetBool("abort")
+		if continueFlag || abortFlag {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
+		continueFlag, _ := cmd.Flags().GetBool("continue")
+		abortFlag, _ := cmd.Flags().GetBool("abort")
+		repo, err := openRepo()
+		if err != nil {
+			log.Fatalf("failed to open repository: %v", err)
+		}
+		switch {
+		case continueFlag:
+			if err := repo.ContinueCheckout(); err != nil {
+				log.Fatalf("failed to finish switch: %v", err)
+			}
+			fmt.Println("Finished interrupted switch")
+			return
+		case abortFlag:
+			if err := repo.AbortCheckout(); err != nil {
+				log.Fatalf("failed to undo switch: %v", err)
+			}
+			fmt.Println("Undid interrupted switch")
+			return
+		}
+
 		branchName := args[0]
 		createFlag, err := cmd.Flags().GetBool("create")
 		if err != nil {
 			log.Fatalf("failed to parse create flag: %v", err)
 		}
-		if err := core.SwitchBranch(branchName, createFlag); err != nil {
+		detachFlag, err := cmd.Flags().GetBool("detach")
+		if err != nil {
+			log.Fatalf("failed to parse detach flag: %v", err)
+		}
+		if createFlag && detachFlag {
+			log.Fatalf("-c and --detach cannot be used together")
+		}
+		left, err := repo.Switch(branchName, gvc.SwitchOptions{Create: createFlag, Detach: detachFlag})
+		if err != nil {
 			log.Fatalf("failed to switch branch: %v", err)
 		}
+		warnLeftBehind(left)
+		if detachFlag {
+			printDetachedHead(repo)
+			return
+		}
 		fmt.Printf("Switched to branch %s\n", branchName)
 	},
 }
+
+// printDetachedHead reports the commit HEAD was detached at.
+func printDetachedHead(repo *gvc.Repository) {
+	head, err := repo.Head()
+	if err != nil {
+		log.Fatalf("failed to read HEAD: %v", err)
+	}
+	fmt.Printf("HEAD is now at %s\n", head.Commit[:7])
+}
+
+// warnLeftBehind warns about the commits of a detached HEAD that no branch
+// or tag reaches anymore.
+func warnLeftBehind(commits []*gvc.Commit) {
+	if len(commits) == 0 {
+		return
+	}
+	fmt.Printf("Warning: you are leaving %d commit(s) behind, not connected to any of your branches:\n\n", len(commits))
+	for _, commit := range commits {
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		fmt.Printf("  %s %s\n", commit.Hash[:7], subject)
+	}
+	fmt.Printf("\nIf you want to keep them, create a branch for them now with:\n\n")
+	fmt.Printf("  gvc switch --detach %s\n  gvc switch -c <new-branch-name>\n\n", commits[0].Hash[:7])
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"fmt"
+	"os/user"
+	"strings"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagOptions     gvc.TagOptions
+	tagListOptions gvc.TagListOptions
+	tagAnnotate    bool
+	tagDelete      bool
+	tagList        bool
+	tagShowMessage bool
+)
+
+func init() {
+	tagCmd.Flags().BoolVarP(&tagAnnotate, "annotate", "a", false, "Create an annotated tag object (needs -m)")
+	tagCmd.Flags().StringVarP(&tagOptions.Message, "message", "m", "", "Tag message, makes the tag annotated")
+	tagCmd.Flags().BoolVarP(&tagOptions.Force, "force", "f", false, "Replace an existing tag")
+	tagCmd.Flags().BoolVarP(&tagDelete, "delete", "d", false, "Delete the given tags")
+	tagCmd.Flags().BoolVarP(&tagList, "list", "l", false, "List tags, only those matching the given patterns if any")
+	tagCmd.Flags().StringVar(&tagListOptions.Sort, "sort", "", "Sort by \"refname\" or \"version:refname\", prefix with - to reverse")
+	tagCmd.Flags().BoolVarP(&tagShowMessage, "n", "n", false, "Print the first line of each tag message when listing")
+	rootCmd.AddCommand(tagCmd)
+}
+
+var tagCmd = &cobra.Command{
+	Use:   "tag [name [commit]]",
+	Short: "Create, list or delete tags",
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, err := openRepo()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		switch {
+		case tagDelete:
+			if len(args) == 0 {
+				fmt.Println("Error: no tag name given to delete")
+				return
+			}
+			for _, name := range args {
+				hash, err := repo.DeleteTag(name)
+				if err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				fmt.Printf("Deleted tag '%s' (was %s)\n", name, hash[:7])
+			}
+
+		case tagList || len(args) == 0:
+			tagListOptions.Patterns = args
+			tags, err := repo.Tags(tagListOptions)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			for _, tag := range tags {
+				if !tagShowMessage {
+					fmt.Println(tag.Name)
+					continue
+				}
+				subject, _, _ := strings.Cut(tag.Message, "\n")
+				fmt.Printf("%-15s %s\n", tag.Name, subject)
+			}
+
+		default:
+			if len(args) > 2 {
+				fmt.Println("Error: too many arguments, expected a tag name and a commit")
+				return
+			}
+			if tagAnnotate && tagOptions.Message == "" {
+				fmt.Println("Error: annotated tags need a message (-m)")
+				return
+			}
+			if tagOptions.Message != "" {
+				user, err := user.Current()
+				if err != nil {
+					fmt.Println("Error getting user info:", err)
+					return
+				}
+				tagOptions.Tagger = user.Username
+			}
+			target := ""
+			if len(args) == 2 {
+				target = args[1]
+			}
+			if _, err := repo.CreateTag(args[0], target, tagOptions); err != nil {
+				fmt.Println("Error:", err)
+			}
+		}
+	},
+}
@@ -2,14 +2,16 @@ module github.com/aryandutt/gvc
 
 go 1.23.1
 
-require github.com/spf13/cobra v1.8.1
+require (
+	github.com/fatih/color v1.18.0
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/spf13/cobra v1.8.1
+)
 
 require (
-	github.com/fatih/color v1.18.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 )
@@ -2,97 +2,214 @@ package core
 
 import (
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
 
-// AddToStage adds a file or dir to the staging area.
-func AddToStage(filePath string) error {
-	fileInfo, err := os.Stat(filePath)
-	if (err != nil) {
+// AddToStage adds a file or dir to the staging area. filePath may be absolute
+// or relative to the current directory.
+func (r *Repo) AddToStage(filePath string) error {
+	relPath, err := r.RelPath(filePath)
+	if err != nil {
+		return err
+	}
+	absPath := r.workPath(relPath)
+
+	fileInfo, err := os.Lstat(absPath) // Symlinks are staged, not followed
+	if err != nil {
 		return fmt.Errorf("failed to stat file: %v", err)
 	}
 
 	if fileInfo.IsDir() {
-		entries, err := os.ReadDir(filePath)
+		return r.addDirectory(absPath)
+	}
+	file, err := r.storeFile(relPath, fileInfo)
+	if err != nil {
+		return err
+	}
+	return r.stageFiles([]stagedFile{file})
+}
+
+// Helper: Add the files below a directory, except in hidden directories and
+// untracked files that are ignored. The index is written once at the end.
+func (r *Repo) addDirectory(absPath string) error {
+	index, err := r.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+	tracked := trackedPaths(index)
+	ignore, err := r.newIgnoreMatcher()
+	if err != nil {
+		return err
+	}
+	var files []stagedFile
+	err = filepath.WalkDir(absPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return fmt.Errorf("failed to read directory: %v", err)
+			return err
 		}
-
-		for _, entry := range entries {
-			if entry.IsDir() && entry.Name()[0] == '.' {
-				continue // Ignore hidden directories
-			}
-			entryPath := filepath.Join(filePath, entry.Name())
-			if err := AddToStage(entryPath); err != nil {
+		if path == absPath {
+			return nil
+		}
+		if d.IsDir() && d.Name()[0] == '.' {
+			return filepath.SkipDir // Ignore hidden directories
+		}
+		relPath, err := r.RelPath(path)
+		if err != nil {
+			return err
+		}
+		if !tracked[relPath] {
+			if match, err := ignore.ignored(relPath, d.IsDir()); err != nil {
 				return err
+			} else if match != nil && d.IsDir() {
+				return filepath.SkipDir
+			} else if match != nil {
+				return nil
 			}
 		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %v", err)
+		}
+		file, err := r.storeFile(relPath, info)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
 		return nil
+	})
+	if err != nil {
+		return err
 	}
+	return r.stageFiles(files)
+}
 
-	// 1. Create blob from file content
-	blobHash, err := createBlobFromFile(filePath)
+// stagedFile is a file whose content is stored and that is about to be
+// recorded in the index.
+type stagedFile struct {
+	relPath string
+	info    os.FileInfo // Taken before reading, so later edits are noticed
+	hash    string
+	objType string
+}
+
+// Helper: Store the content of a file, or the target of a symlink
+func (r *Repo) storeFile(relPath string, info os.FileInfo) (stagedFile, error) {
+	absPath := r.workPath(relPath)
+	file := stagedFile{relPath: relPath, info: info}
+	var err error
+	if info.Mode()&os.ModeSymlink != 0 {
+		file.hash, err = r.createBlobFromSymlink(absPath)
+	} else {
+		file.hash, file.objType, err = r.createBlobFromFile(absPath, relPath)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create blob: %v", err)
+		return file, fmt.Errorf("failed to create blob: %v", err)
 	}
+	return file, nil
+}
 
-	// 2. Update index
-	index, err := LoadIndex()
+// Helper: Record stored files in the index, replacing their entries, with a
+// single write of the index
+func (r *Repo) stageFiles(files []stagedFile) error {
+	if err := r.checkNoInterruptedCheckout(); err != nil {
+		return err
+	}
+	lock, err := r.lockIndex()
 	if err != nil {
-		return fmt.Errorf("failed to load index: %v", err)
+		return err
+	}
+	defer lock.rollback()
+	index, err := r.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
 	}
 
-	// Remove existing entry if file is already staged
-	newIndex := removeEntry(index, filePath)
-
-	// fileType := "100644"
-	// if fileInfo.Mode().Perm()&0111 != 0 {
-	// 	fileType = "100755"
-	// }
-
-	// TODO: Fix file type when MatchCommitWithDirectory is fixed
-	// Add new entry
-	*newIndex = append(*newIndex, IndexEntry{
-		Path:     filePath,
-		BlobHash: blobHash,
-		Type:     "100644",
-	})
+	staged := make(map[string]bool, len(files))
+	for _, file := range files {
+		staged[file.relPath] = true
+	}
+	newIndex := &Index{}
+	indexModes := make(map[string]string)
+	for _, entry := range *index {
+		if staged[entry.Path] {
+			indexModes[entry.Path] = entry.Type
+		} else {
+			*newIndex = append(*newIndex, entry)
+		}
+	}
+	for _, file := range files {
+		*newIndex = append(*newIndex, IndexEntry{
+			Path:     file.relPath,
+			BlobHash: file.hash,
+			Type:     r.workFileMode(file.info, indexModes[file.relPath]),
+			ObjType:  file.objType,
+			Stat:     fileStatOf(file.info),
+		})
+	}
 
-	if err := newIndex.SaveIndex(); err != nil {
+	if err := r.writeIndex(lock, newIndex); err != nil {
 		return fmt.Errorf("failed to save index: %v", err)
 	}
-
 	return nil
 }
 
-// Helper: Remove existing entries for a file path
-func removeEntry(index *Index, path string) *Index {
-    cleanPath := filepath.Clean(path)
-    newIndex := &Index{} // Creates a pointer to a new Index
-    
-    for _, entry := range *index {
-        if entry.Path != cleanPath {
-			*newIndex = append(*newIndex, entry)
-        }
-    }
-    
-    return newIndex
-}
-
-// Helper: Create blob from file content
-func createBlobFromFile(filePath string) (string, error) {
+// Helper: Create blob from file content, streaming it into the object store.
+// Files tracked by LFS go to the LFS store and the blob is their pointer;
+// chunked files are stored as a chunks object. Returns the hash and the
+// index object type.
+func (r *Repo) createBlobFromFile(filePath, relPath string) (string, string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer file.Close()
 
-	content, err := io.ReadAll(file)
+	attrs, err := r.loadAttributes()
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case matchesAnyPattern(attrs.lfs, relPath):
+		pointer, err := r.storeLFSObject(file)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to store large file: %v", err)
+		}
+		hash, err := r.CreateObject("blob", pointer.Bytes())
+		return hash, "", err
+	case matchesAnyPattern(attrs.chunked, relPath):
+		hash, err := r.chunkStream(file, true)
+		return hash, "chunks", err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := r.CreateObjectFromReader("blob", info.Size(), file)
+	return hash, "", err
+}
+
+// Helper: Store the target of a symlink as a blob, as git does
+func (r *Repo) createBlobFromSymlink(linkPath string) (string, error) {
+	target, err := os.Readlink(linkPath)
 	if err != nil {
 		return "", err
 	}
+	return r.CreateObject("blob", []byte(target))
+}
 
-	return CreateObject("blob", content)
+// Helper: Set of the tracked files and the directories containing them
+func trackedPaths(index *Index) map[string]bool {
+	tracked := make(map[string]bool, len(*index))
+	for _, entry := range *index {
+		tracked[entry.Path] = true
+		for dir := parentDir(entry.Path); dir != "" && !tracked[dir]; dir = parentDir(dir) {
+			tracked[dir] = true
+		}
+	}
+	return tracked
 }
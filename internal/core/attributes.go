@@ -0,0 +1,61 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// AttributesFile assigns attributes to paths, one "pattern attr..." line per
+// rule as in .gitattributes. gvc acts on "filter=lfs" (see lfs.go) and
+// "chunked" (see chunk.go).
+const AttributesFile = ".gvcattributes"
+
+// pathAttributes holds the patterns of each attribute gvc acts on.
+type pathAttributes struct {
+	lfs     []string
+	chunked []string
+}
+
+// Helper: Read .gvcattributes from the top of the work tree
+func (r *Repo) loadAttributes() (*pathAttributes, error) {
+	data, err := os.ReadFile(r.workPath(AttributesFile))
+	if os.IsNotExist(err) {
+		return &pathAttributes{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", AttributesFile, err)
+	}
+	attrs := &pathAttributes{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, attr := range fields[1:] {
+			switch attr {
+			case "filter=lfs":
+				attrs.lfs = append(attrs.lfs, fields[0])
+			case "chunked":
+				attrs.chunked = append(attrs.chunked, fields[0])
+			}
+		}
+	}
+	return attrs, nil
+}
+
+// Helper: Reports whether relPath matches one of patterns. Patterns without a
+// slash match the base name in any directory, like gitattributes.
+func matchesAnyPattern(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		target := relPath
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(relPath)
+		}
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -2,75 +2,233 @@ package core
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
-
-	"github.com/fatih/color"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
-func SwitchBranch(branch string, create bool) error {
+// SwitchBranch points HEAD at branch, checking out its commit, or with create
+// makes a new branch at the current commit. Branches without a commit yet
+// are unborn and switching to them only moves HEAD. It returns the commits a detached
+// HEAD leaves behind, see leftBehind.
+func (r *Repo) SwitchBranch(branch string, create bool) ([]*Commit, error) {
+	if err := r.checkNoInterruptedCheckout(); err != nil {
+		return nil, err
+	}
+	if err := checkRefName(branch); err != nil {
+		return nil, err
+	}
 	// Read the HEAD file
 	if create {
-		currentCommit, err := getCurrentCommit()
+		oldRef, currentCommit, err := r.readHead()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		newBranch := fmt.Sprintf(".gvc/refs/heads/%s", branch)
-		err = os.WriteFile(newBranch, []byte(currentCommit), 0644)
-		if err != nil {
-			return err
+		if err := r.createBranch(branch, currentCommit); err != nil {
+			return nil, err
 		}
 		// Update HEAD to point to the new branch
 		headRefPath := fmt.Sprintf("refs/heads/%s", branch)
-		err = os.WriteFile(".gvc/HEAD", []byte(fmt.Sprintf("ref: %s", headRefPath)), 0644)
-		return err
+		err = writeLocked(r.gvcPath("HEAD"), []byte(fmt.Sprintf("ref: %s", headRefPath)), 0644)
+		if err != nil || currentCommit == "" {
+			return nil, err
+		}
+		if err := r.appendReflog(headRefPath, "", currentCommit, "branch: Created from HEAD"); err != nil {
+			return nil, err
+		}
+		return nil, r.appendReflog("HEAD", currentCommit, currentCommit, checkoutMessage(oldRef, currentCommit, branch))
 	}
-	isClean, err := IsWorkingDirClean()
-	if err != nil {
-		return err
+	headRefPath := fmt.Sprintf("refs/heads/%s", branch)
+	changedCommit, err := os.ReadFile(r.gvcPath(headRefPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
 	}
-	if !isClean {
-		return fmt.Errorf("working directory is not clean, commit or stash changes before switching branches")
+	if commitHash := strings.TrimSpace(string(changedCommit)); commitHash != "" {
+		// Match the working dir with the new branch and point HEAD to it
+		return r.moveHead(commitHash, fmt.Sprintf("ref: %s", headRefPath), branch)
 	}
-	newBranch := fmt.Sprintf(".gvc/refs/heads/%s", branch)
-	_, err = os.Stat(newBranch)
+	// An empty ref, or a missing one while HEAD has no commit either, is an
+	// unborn branch: there is nothing to check out until its first commit
 	if os.IsNotExist(err) {
-		return fmt.Errorf("branch '%s' does not exist, use the -c flag to create a new branch", branch)
-	} else if err != nil {
+		_, currentCommit, err := r.readHead()
+		if err != nil {
+			return nil, err
+		}
+		if currentCommit != "" {
+			return nil, fmt.Errorf("branch '%s' does not exist, use the -c flag to create a new branch", branch)
+		}
+	}
+	return nil, writeLocked(r.gvcPath("HEAD"), []byte(fmt.Sprintf("ref: %s", headRefPath)), 0644)
+}
+
+// Helper: Create the ref for branch at commitHash, failing if it already
+// exists. The check happens under the ref's lock, so two processes creating
+// the same branch cannot both succeed. Without a commit the branch stays
+// unborn and no ref is written.
+func (r *Repo) createBranch(branch, commitHash string) error {
+	refPath := r.gvcPath("refs", "heads", branch)
+	// Branches like feature/x live in subdirectories
+	if err := os.MkdirAll(filepath.Dir(refPath), 0755); err != nil {
 		return err
 	}
-	// Match the working dir with the new branch
-	changedCommit, err := os.ReadFile(newBranch)
+	lock, err := acquireLock(refPath)
 	if err != nil {
 		return err
 	}
-	err = MatchDirectoryWithCommit(string(changedCommit))
-	if err != nil {
+	defer lock.rollback()
+	if _, err := os.Stat(refPath); err == nil {
+		return fmt.Errorf("a branch named '%s' already exists", branch)
+	} else if !os.IsNotExist(err) {
 		return err
 	}
-	// Update HEAD to point to the new branch
-	headRefPath := fmt.Sprintf("refs/heads/%s", branch)
-	err = os.WriteFile(".gvc/HEAD", []byte(fmt.Sprintf("ref: %s", headRefPath)), 0644)
-	return err
+	if commitHash == "" {
+		return nil
+	}
+	if _, err := lock.Write([]byte(commitHash)); err != nil {
+		return fmt.Errorf("failed to write %s: %v", refPath, err)
+	}
+	return lock.commit(0644)
 }
 
-func ListBranch() error {
-	branches, err := os.ReadDir(".gvc/refs/heads")
+// DetachHead checks out the commit rev resolves to and points HEAD straight
+// at it rather than at a branch. Commits made from there move only HEAD. It
+// returns the commits a detached HEAD leaves behind, see leftBehind.
+func (r *Repo) DetachHead(rev string) ([]*Commit, error) {
+	if err := r.checkNoInterruptedCheckout(); err != nil {
+		return nil, err
+	}
+	commitHash, err := r.ResolveCommit(rev)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// color the current branch green
-	headRef, err := os.ReadFile(".gvc/HEAD")
+	return r.moveHead(commitHash, commitHash, rev)
+}
+
+// Helper: Check out commitHash with a clean working directory and set HEAD
+// to newHead, returning the commits left behind. target is what the user
+// switched to, for the reflog.
+func (r *Repo) moveHead(commitHash, newHead, target string) ([]*Commit, error) {
+	isClean, err := r.IsWorkingDirClean()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	green := color.New(color.FgGreen).SprintFunc()
-	currentBranch := string(headRef)[16:]
-	for _, branch := range branches {
-		if branch.Name() == currentBranch {
-			fmt.Printf("%s *\n", green(branch.Name()))
+	if !isClean {
+		return nil, fmt.Errorf("working directory is not clean, commit or stash changes before switching branches")
+	}
+	oldRef, oldCommit, err := r.readHead()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.CheckoutCommit(commitHash, newHead); err != nil {
+		return nil, err
+	}
+	if err := r.appendReflog("HEAD", oldCommit, commitHash, checkoutMessage(oldRef, oldCommit, target)); err != nil {
+		return nil, err
+	}
+	if oldRef != "" || oldCommit == "" {
+		return nil, nil
+	}
+	return r.leftBehind(oldCommit)
+}
+
+// Helper: The commits from hash back that neither a branch, a tag nor HEAD
+// reaches, newest first. Called after HEAD moved away from a detached hash,
+// these commits can only be found again by their hash.
+func (r *Repo) leftBehind(hash string) ([]*Commit, error) {
+	refs, err := r.ListRefs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %v", err)
+	}
+	head, err := r.getCurrentCommit()
+	if err != nil {
+		return nil, err
+	}
+	tips := []string{head}
+	for _, tip := range refs {
+		tips = append(tips, tip)
+	}
+	reachable := make(map[string]bool)
+	for _, tip := range tips {
+		if tip == "" {
+			continue
+		}
+		commitHash, typ, err := r.peelTags(tip, nil)
+		if err != nil {
+			return nil, err
+		}
+		if typ != "commit" {
 			continue
 		}
-		fmt.Println(branch.Name())
+		ancestors, err := r.ancestors(commitHash)
+		if err != nil {
+			return nil, err
+		}
+		for ancestor := range ancestors {
+			reachable[ancestor] = true
+		}
+	}
+
+	var commits []*Commit
+	for hash != "" && !reachable[hash] {
+		commit, err := r.GetCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit)
+		hash = commit.Parent
+	}
+	return commits, nil
+}
+
+// Helper: Reflog message for HEAD moving away from the branch refPath, or
+// the commit oldCommit when detached, to target
+func checkoutMessage(refPath, oldCommit, target string) string {
+	from := strings.TrimPrefix(refPath, "refs/heads/")
+	if refPath == "" {
+		from = oldCommit
+	}
+	return fmt.Sprintf("checkout: moving from %s to %s", from, target)
+}
+
+// ListBranch returns the names of all branches in sorted order, including
+// those in subdirectories such as feature/x.
+func (r *Repo) ListBranch() ([]string, error) {
+	headsDir := r.gvcPath("refs", "heads")
+	var branches []string
+	err := filepath.WalkDir(headsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(headsDir, path)
+		if err != nil {
+			return err
+		}
+		branches = append(branches, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	sort.Strings(branches)
+	return branches, nil
+}
+
+// CurrentBranch returns the name of the branch HEAD points to, or "" when
+// HEAD is detached.
+func (r *Repo) CurrentBranch() (string, error) {
+	refPath, _, err := r.readHead()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(refPath, "refs/heads/"), nil
+}
+
+// HeadCommit returns the commit HEAD points to, "" before the first commit.
+func (r *Repo) HeadCommit() (string, error) {
+	return r.getCurrentCommit()
 }
@@ -0,0 +1,395 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Checkout is a transaction over the work tree, the index and HEAD. A plan
+// listing every file and directory to change is computed and validated before
+// anything is touched, then saved to .gvc/CHECKOUT_JOURNAL and applied. Every
+// step of a plan can be repeated, so after a crash RecoverCheckout finishes
+// the checkout or undoes it, whichever is asked for.
+
+const checkoutJournalFile = "CHECKOUT_JOURNAL"
+
+// ErrCheckoutInterrupted is returned while the journal of a checkout that
+// did not finish is present.
+var ErrCheckoutInterrupted = errors.New("a checkout was interrupted, run 'gvc switch --continue' to finish it or 'gvc switch --abort' to undo it")
+
+// checkoutOp changes one tracked file. An empty OldHash creates the file, an
+// empty NewHash deletes it.
+type checkoutOp struct {
+	Path    string `json:"path"`
+	OldHash string `json:"oldHash,omitempty"`
+	OldType string `json:"oldType,omitempty"` // "chunks" for chunked files, empty for blobs
+	OldMode string `json:"oldMode,omitempty"`
+	NewHash string `json:"newHash,omitempty"`
+	NewType string `json:"newType,omitempty"`
+	NewMode string `json:"newMode,omitempty"`
+}
+
+// Helper: The state of the file once the op is applied, or undone
+func (op checkoutOp) target(forward bool) (hash, objType, mode string) {
+	if forward {
+		return op.NewHash, op.NewType, op.NewMode
+	}
+	return op.OldHash, op.OldType, op.OldMode
+}
+
+// checkoutPlan is the journal of a checkout.
+type checkoutPlan struct {
+	Commit  string       `json:"commit"`
+	OldHead string       `json:"oldHead"`
+	NewHead string       `json:"newHead,omitempty"` // Empty leaves HEAD alone
+	Ops     []checkoutOp `json:"ops"`
+	Mkdirs  []string     `json:"mkdirs,omitempty"` // Directories to create, parents first
+	Rmdirs  []string     `json:"rmdirs,omitempty"` // Directories to remove once empty, children first
+}
+
+// CheckoutCommit makes the work tree and the index match commitHash and then
+// sets HEAD to newHead (e.g. "ref: refs/heads/main"), or leaves it alone if
+// newHead is empty. Nothing is changed if a file would be lost.
+func (r *Repo) CheckoutCommit(commitHash, newHead string) error {
+	return r.checkoutCommit(commitHash, newHead, false)
+}
+
+// Helper: CheckoutCommit, which with force discards local changes to
+// tracked files instead of refusing to lose them
+func (r *Repo) checkoutCommit(commitHash, newHead string, force bool) error {
+	if err := r.checkNoInterruptedCheckout(); err != nil {
+		return err
+	}
+	wdMap, err := r.ScanWorkingDir()
+	if err != nil {
+		return fmt.Errorf("failed to scan working dir: %v", err)
+	}
+	lock, err := r.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+	index, err := r.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+
+	plan, err := r.planCheckout(commitHash, newHead, index)
+	if err != nil {
+		return err
+	}
+	if force {
+		planDiscard(plan, index, wdMap)
+	}
+	if err := r.validateCheckout(plan, wdMap, force); err != nil {
+		return err
+	}
+	journal, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	if err := writeLocked(r.gvcPath(checkoutJournalFile), journal, 0644); err != nil {
+		return fmt.Errorf("failed to write checkout journal: %v", err)
+	}
+	return r.applyCheckout(lock, plan, index, true)
+}
+
+// RecoverCheckout finishes a checkout that was interrupted, or with forward
+// unset restores the files, index and HEAD from before it started.
+func (r *Repo) RecoverCheckout(forward bool) error {
+	data, err := os.ReadFile(r.gvcPath(checkoutJournalFile))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no interrupted checkout to recover")
+	} else if err != nil {
+		return err
+	}
+	plan := &checkoutPlan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return fmt.Errorf("failed to parse checkout journal: %v", err)
+	}
+	lock, err := r.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+	index, err := r.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+	return r.applyCheckout(lock, plan, index, forward)
+}
+
+// Helper: Fail if a checkout journal is present
+func (r *Repo) checkNoInterruptedCheckout() error {
+	if _, err := os.Stat(r.gvcPath(checkoutJournalFile)); err == nil {
+		return ErrCheckoutInterrupted
+	}
+	return nil
+}
+
+// Helper: The changes turning the files in index into those of commitHash
+func (r *Repo) planCheckout(commitHash, newHead string, index *Index) (*checkoutPlan, error) {
+	commit, err := r.GetCommit(commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit: %v", err)
+	}
+	treeFiles, err := r.GetTreeEntries(commit.Tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree files: %v", err)
+	}
+	oldHead, err := os.ReadFile(r.gvcPath("HEAD"))
+	if err != nil {
+		return nil, err
+	}
+	plan := &checkoutPlan{Commit: commitHash, OldHead: string(oldHead), NewHead: newHead}
+
+	inIndex := make(map[string]bool, len(*index))
+	for _, entry := range *index {
+		inIndex[entry.Path] = true
+		op := checkoutOp{Path: entry.Path, OldHash: entry.BlobHash, OldType: entry.ObjType, OldMode: entry.Type}
+		treeEntry, exists := treeFiles[entry.Path]
+		if exists {
+			if treeEntry.Hash == entry.BlobHash && treeEntry.Mode == entry.Type {
+				continue
+			}
+			op.NewHash, op.NewType, op.NewMode = treeEntry.Hash, treeObjType(treeEntry), treeEntry.Mode
+		}
+		plan.Ops = append(plan.Ops, op)
+	}
+	for path, treeEntry := range treeFiles {
+		if !inIndex[path] {
+			plan.Ops = append(plan.Ops, checkoutOp{Path: path, NewHash: treeEntry.Hash, NewType: treeObjType(treeEntry), NewMode: treeEntry.Mode})
+		}
+	}
+	sort.Slice(plan.Ops, func(i, j int) bool { return plan.Ops[i].Path < plan.Ops[j].Path })
+
+	// Directories holding files of the new commit are kept or created, the
+	// ones emptied by deletions are removed
+	targetDirs := make(map[string]bool)
+	for path := range treeFiles {
+		for dir := parentDir(path); dir != ""; dir = parentDir(dir) {
+			targetDirs[dir] = true
+		}
+	}
+	mkdirs, rmdirs := make(map[string]bool), make(map[string]bool)
+	for _, op := range plan.Ops {
+		for dir := parentDir(op.Path); dir != ""; dir = parentDir(dir) {
+			if op.NewHash != "" {
+				if info, err := os.Lstat(r.workPath(dir)); err != nil || !info.IsDir() {
+					mkdirs[dir] = true
+				}
+			} else if !targetDirs[dir] {
+				rmdirs[dir] = true
+			}
+		}
+	}
+	plan.Mkdirs = sortedKeys(mkdirs)
+	plan.Rmdirs = sortedKeys(rmdirs)
+	sort.Sort(sort.Reverse(sort.StringSlice(plan.Rmdirs)))
+	return plan, nil
+}
+
+// Helper: Add ops rewriting the tracked files the plan leaves alone but
+// whose working copy differs from the index
+func planDiscard(plan *checkoutPlan, index *Index, wdMap map[string]WorkFile) {
+	planned := make(map[string]bool, len(plan.Ops))
+	for _, op := range plan.Ops {
+		planned[op.Path] = true
+	}
+	for _, entry := range *index {
+		current, exists := wdMap[entry.Path]
+		if planned[entry.Path] || exists && current.Hash == entry.BlobHash && current.Mode == entry.Type {
+			continue
+		}
+		plan.Ops = append(plan.Ops, checkoutOp{
+			Path: entry.Path, OldHash: entry.BlobHash, OldType: entry.ObjType, OldMode: entry.Type,
+			NewHash: entry.BlobHash, NewType: entry.ObjType, NewMode: entry.Type,
+		})
+	}
+	sort.Slice(plan.Ops, func(i, j int) bool { return plan.Ops[i].Path < plan.Ops[j].Path })
+}
+
+// Helper: Check the plan can be applied without losing work: files about to
+// be replaced must match the index unless force is set, untracked files and
+// directories must not be in the way, and every directory written to must be
+// writable
+func (r *Repo) validateCheckout(plan *checkoutPlan, wdMap map[string]WorkFile, force bool) error {
+	deleted := make(map[string]bool)
+	for _, op := range plan.Ops {
+		if op.NewHash == "" {
+			deleted[op.Path] = true
+		}
+	}
+	var modified []string
+	overwritten, probeDirs := make(map[string]bool), make(map[string]bool)
+	for _, op := range plan.Ops {
+		current, exists := wdMap[op.Path]
+		if op.OldHash == "" {
+			info, err := os.Lstat(r.workPath(op.Path))
+			if err == nil && info.IsDir() {
+				for _, path := range r.untrackedFilesIn(op.Path, deleted) {
+					overwritten[path] = true
+				}
+			} else if err == nil && current.Hash != op.NewHash {
+				overwritten[op.Path] = true
+			}
+		} else if !force && exists && current.Hash != op.OldHash {
+			modified = append(modified, op.Path)
+		}
+
+		// Files in the way of a directory the new commit needs
+		dir := parentDir(op.Path)
+		for ; dir != ""; dir = parentDir(dir) {
+			info, err := os.Lstat(r.workPath(dir))
+			if err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				if op.NewHash != "" && !deleted[dir] {
+					overwritten[dir] = true
+				}
+				continue
+			}
+			break
+		}
+		probeDirs[dir] = true
+	}
+	if len(overwritten) > 0 {
+		return fmt.Errorf("checkout would overwrite untracked files:\n\t%s\nmove or remove them first", strings.Join(sortedKeys(overwritten), "\n\t"))
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("checkout would discard local changes to:\n\t%s\ncommit them first", strings.Join(modified, "\n\t"))
+	}
+
+	for _, dir := range sortedKeys(probeDirs) {
+		probe, err := os.CreateTemp(r.workPath(dir), ".gvc-probe-")
+		if err != nil {
+			return fmt.Errorf("cannot write to directory '%s': %v", dir, err)
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+	return nil
+}
+
+// Helper: Apply the plan, or undo it with forward unset, then update the
+// index through lock and HEAD, and remove the journal. Files already in their
+// target state are rewritten harmlessly, so this can run any number of times.
+func (r *Repo) applyCheckout(lock *lockFile, plan *checkoutPlan, index *Index, forward bool) error {
+	for _, op := range plan.Ops {
+		if hash, _, _ := op.target(forward); hash == "" {
+			if err := os.Remove(r.workPath(op.Path)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove file: %v", err)
+			}
+		}
+	}
+
+	// os.Remove fails on directories that are not empty, e.g. because of
+	// untracked files, which keeps them
+	removeDirs := plan.Rmdirs
+	if !forward {
+		removeDirs = append([]string(nil), plan.Mkdirs...)
+		sort.Sort(sort.Reverse(sort.StringSlice(removeDirs)))
+	}
+	for _, dir := range removeDirs {
+		os.Remove(r.workPath(dir))
+	}
+	if forward {
+		for _, dir := range plan.Mkdirs {
+			// A file deleted above may have been in the way
+			if err := os.MkdirAll(r.workPath(dir), 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %v", err)
+			}
+		}
+	}
+
+	changed := make(map[string]bool, len(plan.Ops))
+	newIndex := &Index{}
+	for _, op := range plan.Ops {
+		changed[op.Path] = true
+		hash, objType, mode := op.target(forward)
+		if hash == "" {
+			continue
+		}
+		filePath := r.workPath(op.Path)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		if err := r.writeBlobToFile(hash, filePath, mode); err != nil {
+			return fmt.Errorf("failed to write file: %v", err)
+		}
+		entry := IndexEntry{Path: op.Path, BlobHash: hash, Type: mode, ObjType: objType}
+		if info, err := os.Lstat(filePath); err == nil {
+			entry.Stat = fileStatOf(info)
+		}
+		*newIndex = append(*newIndex, entry)
+	}
+	for _, entry := range *index {
+		if !changed[entry.Path] {
+			*newIndex = append(*newIndex, entry)
+		}
+	}
+
+	if err := r.writeIndex(lock, newIndex); err != nil {
+		return fmt.Errorf("failed to save index: %v", err)
+	}
+	head := plan.OldHead
+	if forward {
+		head = plan.NewHead
+	}
+	if plan.NewHead != "" {
+		if err := writeLocked(r.gvcPath("HEAD"), []byte(head), 0644); err != nil {
+			return fmt.Errorf("failed to update HEAD: %v", err)
+		}
+	}
+	return os.Remove(r.gvcPath(checkoutJournalFile))
+}
+
+// Helper: Files under the directory dir that the checkout does not delete
+func (r *Repo) untrackedFilesIn(dir string, deleted map[string]bool) []string {
+	var files []string
+	filepath.WalkDir(r.workPath(dir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(r.WorkTree, path)
+		if err == nil && !deleted[filepath.ToSlash(relPath)] {
+			files = append(files, filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+	return files
+}
+
+// Helper: Index object type of a tree entry, empty for blobs
+func treeObjType(entry TreeEntry) string {
+	if entry.Type == "blob" {
+		return ""
+	}
+	return entry.Type
+}
+
+// Helper: Parent of a slash-separated repo-relative path, empty at the top
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Files with the "chunked" attribute in .gvcattributes are split into
+// content-defined chunks, each stored as a blob, and recorded as a "chunks"
+// object listing them. A chunk boundary depends only on the bytes just
+// before it, so an edit changes the chunks around it and revisions share
+// the rest.
+
+const (
+	minChunkSize = 16 << 10
+	maxChunkSize = 256 << 10
+	avgChunkBits = 16 // Boundaries occur every 64 KiB on average
+)
+
+// gearTable maps bytes to random values for the rolling hash. It is generated
+// from a fixed seed; changing it would move every chunk boundary.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0)
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// chunkRef is a chunk blob listed in a chunks object.
+type chunkRef struct {
+	Hash string
+	Size int64
+}
+
+// chunker splits a stream into content-defined chunks with a gear hash.
+type chunker struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: bufio.NewReaderSize(r, maxChunkSize), buf: make([]byte, 0, maxChunkSize)}
+}
+
+// next returns the next chunk, valid until the following call, or io.EOF.
+func (c *chunker) next() ([]byte, error) {
+	// The top bits of the gear hash depend on the last 64 bytes read
+	const mask = (uint64(1)<<avgChunkBits - 1) << (64 - avgChunkBits)
+	c.buf = c.buf[:0]
+	var h uint64
+	for len(c.buf) < maxChunkSize {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		h = h<<1 + gearTable[b]
+		if len(c.buf) >= minChunkSize && h&mask == 0 {
+			break
+		}
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	return c.buf, nil
+}
+
+// Helper: Split src into chunks and return the hash of its chunks object.
+// With store set the chunks and the list are written, otherwise only hashed.
+func (r *Repo) chunkStream(src io.Reader, store bool) (string, error) {
+	c := newChunker(src)
+	var list strings.Builder
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		var hash string
+		if store {
+			if hash, err = r.CreateObject("blob", chunk); err != nil {
+				return "", err
+			}
+		} else {
+			hash, _ = r.GetObjectData("blob", chunk)
+		}
+		fmt.Fprintf(&list, "%s %d\n", hash, len(chunk))
+	}
+	if store {
+		return r.CreateObject("chunks", []byte(list.String()))
+	}
+	hash, _ := r.GetObjectData("chunks", []byte(list.String()))
+	return hash, nil
+}
+
+// Helper: Parse chunks object content, one "hash size" line per chunk
+func parseChunkList(hash string, content []byte) ([]chunkRef, error) {
+	var chunks []chunkRef
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+		chunkHash, sizeField, found := strings.Cut(line, " ")
+		size, err := strconv.ParseInt(sizeField, 10, 64)
+		if !found || err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid chunks object %s: malformed entry %q", hash, line)
+		}
+		chunks = append(chunks, chunkRef{Hash: chunkHash, Size: size})
+	}
+	return chunks, nil
+}
+
+// chunkReader reads the content of a chunked file, opening one chunk at a time.
+type chunkReader struct {
+	repo   *Repo
+	chunks []chunkRef
+	cur    io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			ref := c.chunks[0]
+			c.chunks = c.chunks[1:]
+			typ, size, content, err := c.repo.OpenObject(ref.Hash)
+			if err != nil {
+				return 0, fmt.Errorf("failed to open chunk: %v", err)
+			}
+			if typ != "blob" || size != ref.Size {
+				content.Close()
+				return 0, fmt.Errorf("chunk %s is a %s of %d bytes, expected a blob of %d", ref.Hash, typ, size, ref.Size)
+			}
+			c.cur = content
+		}
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			c.cur.Close()
+			c.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.cur == nil {
+		return nil
+	}
+	return c.cur.Close()
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Clean deletes the untracked files in the working directory and returns
+// their paths. Ignored files are only deleted with ignored set, and hidden
+// directories are skipped as by status. With dryRun set nothing is deleted.
+func (r *Repo) Clean(ignored, dryRun bool) ([]string, error) {
+	index, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	tracked := trackedPaths(index)
+	ignore, err := r.newIgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	err = filepath.WalkDir(r.WorkTree, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == r.WorkTree {
+			return nil
+		}
+		if d.IsDir() && d.Name()[0] == '.' {
+			return filepath.SkipDir
+		}
+		relPath, err := r.RelPath(path)
+		if err != nil {
+			return err
+		}
+		if tracked[relPath] {
+			return nil
+		}
+		if !ignored {
+			if match, err := ignore.ignored(relPath, d.IsDir()); err != nil {
+				return err
+			} else if match != nil && d.IsDir() {
+				return filepath.SkipDir
+			} else if match != nil {
+				return nil
+			}
+		}
+		if !d.IsDir() {
+			removed = append(removed, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk through working directory: %v", err)
+	}
+
+	if !dryRun {
+		for _, path := range removed {
+			if err := os.Remove(r.workPath(path)); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove file: %v", err)
+			}
+			r.removeEmptyParents(path)
+		}
+	}
+	return removed, nil
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -20,15 +19,18 @@ type Commit struct {
 }
 
 // CreateCommit creates a commit object from the current tree and updates HEAD.
-func CreateCommit(message, author string) (string, error) {
+func (r *Repo) CreateCommit(message, author string) (string, error) {
+	if err := r.checkNoInterruptedCheckout(); err != nil {
+		return "", err
+	}
 	// 1. Create tree from index
-	treeHash, err := CreateTreeFromIndex()
+	treeHash, err := r.CreateTreeFromIndex()
 	if err != nil {
 		return "", fmt.Errorf("create tree: %v", err)
 	}
 
 	// 2. Get parent commit (if exists)
-	parentHash, err := getCurrentCommit() // Returns empty if no parent
+	parentHash, err := r.getCurrentCommit() // Returns empty if no parent
 
 	if err != nil {
 		return "", fmt.Errorf("getting current commit: %v", err)
@@ -41,7 +43,7 @@ func CreateCommit(message, author string) (string, error) {
 		Date:    time.Now(),
 		Message: message,
 		Parent:  parentHash,
-		Tree:   treeHash,
+		Tree:    treeHash,
 	}
 
 	// 4. Build commit content
@@ -61,13 +63,18 @@ func CreateCommit(message, author string) (string, error) {
 	)
 
 	// 5. Save commit object
-	commitHash, err := CreateObject("commit", []byte(commitContent))
+	commitHash, err := r.CreateObject("commit", []byte(commitContent))
 	if err != nil {
 		return "", fmt.Errorf("create commit object: %v", err)
 	}
 
 	// 6. Update HEAD (current branch)
-	if err := updateHead(commitHash); err != nil {
+	subject, _, _ := strings.Cut(message, "\n")
+	reflogMessage := "commit: " + subject
+	if parentHash == "" {
+		reflogMessage = "commit (initial): " + subject
+	}
+	if err := r.updateHead(commitHash, parentHash, reflogMessage); err != nil {
 		return "", fmt.Errorf("update HEAD: %v", err)
 	}
 
@@ -76,10 +83,9 @@ func CreateCommit(message, author string) (string, error) {
 	return commitHash, nil
 }
 
-func GetCommit(hash string) (*Commit, error) {
+func (r *Repo) GetCommit(hash string) (*Commit, error) {
 	// Read commit object from .gvc/objects
-	objectPath := filepath.Join(".gvc", "objects", hash[:2], hash[2:])
-	data, err := os.ReadFile(objectPath)
+	data, err := r.GetObjectContent(hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read commit %s: %v", hash, err)
 	}
@@ -90,8 +96,12 @@ func GetCommit(hash string) (*Commit, error) {
 		return nil, fmt.Errorf("invalid commit object: %s", hash)
 	}
 
-	content := string(parts[1])
-	lines := strings.Split(content, "\n")
+	return parseCommit(hash, parts[1])
+}
+
+// Helper: Parse commit content into a Commit
+func parseCommit(hash string, content []byte) (*Commit, error) {
+	lines := strings.Split(string(content), "\n")
 
 	commit := &Commit{Hash: hash}
 	for i, line := range lines {
@@ -106,37 +116,43 @@ func GetCommit(hash string) (*Commit, error) {
 			commit.Author = strings.Join(fields[1:len(fields)-2], " ") // Extract name/email
 
 			// Parse timestamp
-			timestamp, _ := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			timestamp, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid author timestamp: %s", hash)
+			}
 			commit.Date = time.Unix(timestamp, 0)
-		} else if strings.HasPrefix(line, "tree "){
+		} else if strings.HasPrefix(line, "tree ") {
 			// Example: "tree 7b4d6f3d8e2f6f8d9b6f3f3e8f0e3f0e3f0e3f0"
-			
+
 			commit.Tree = strings.TrimPrefix(line, "tree ")
-		}else if line == "" {
+		} else if line == "" {
 			// Commit message starts after the first empty line
 			commit.Message = strings.Join(lines[i+1:], "\n")
 			break
 		}
 	}
+	if commit.Tree == "" {
+		return nil, fmt.Errorf("invalid commit object, missing tree: %s", hash)
+	}
 
 	return commit, nil
 }
 
 // Compares the tree hash in HEAD with the tree hash for the index.
-func CompareHeadAndIndex() (bool, error) {
+func (r *Repo) CompareHeadAndIndex() (bool, error) {
 	// Get tree hash from HEAD
-	headHash, err := getCurrentCommit()
+	headHash, err := r.getCurrentCommit()
 	if err != nil {
 		return false, fmt.Errorf("getting current commit: %v", err)
 	}
 
-	commit, err := GetCommit(headHash)
+	commit, err := r.GetCommit(headHash)
 	if err != nil {
 		return false, fmt.Errorf("getting commit: %v", err)
 	}
 
 	// Get tree hash from index
-	indexHash, err := CreateTreeFromIndex()
+	indexHash, err := r.CreateTreeFromIndex()
 	if err != nil {
 		return false, fmt.Errorf("creating tree from index: %v", err)
 	}
@@ -145,8 +161,8 @@ func CompareHeadAndIndex() (bool, error) {
 
 }
 
-func IsFirstCommit() (bool, error) {
-	headHash, err := getCurrentCommit()
+func (r *Repo) IsFirstCommit() (bool, error) {
+	headHash, err := r.getCurrentCommit()
 	if err != nil {
 		return false, fmt.Errorf("getting current commit: %v", err)
 	}
@@ -155,31 +171,50 @@ func IsFirstCommit() (bool, error) {
 }
 
 // Helper: Get the current commit hash from HEAD
-func getCurrentCommit() (string, error) {
-	headRef, err := os.ReadFile(".gvc/HEAD")
+func (r *Repo) getCurrentCommit() (string, error) {
+	_, commitHash, err := r.readHead()
+	return commitHash, err
+}
+
+// Helper: Read HEAD, which is either "ref: refs/heads/<branch>" or, when
+// detached, a commit hash. Returns the ref HEAD points to ("" if detached)
+// and the current commit ("" before the first commit on the branch).
+func (r *Repo) readHead() (string, string, error) {
+	data, err := os.ReadFile(r.gvcPath("HEAD"))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-
-	// If HEAD points to a branch (e.g., "ref: refs/heads/main")
-	refPath := string(headRef)[5:] // Remove "ref: "
-	commitHash, err := os.ReadFile(filepath.Join(".gvc", refPath))
+	head := strings.TrimSpace(string(data))
+	refPath, symbolic := strings.CutPrefix(head, "ref: ")
+	if !symbolic {
+		if !r.Format.IsValidHash(head) {
+			return "", "", fmt.Errorf("invalid HEAD '%s'", head)
+		}
+		return "", head, nil
+	}
+	commitHash, err := os.ReadFile(r.gvcPath(refPath))
 	if os.IsNotExist(err) {
-		return "", nil // No parent (first commit)
+		return refPath, "", nil // No parent (first commit)
 	} else if err != nil {
-		return "", err
+		return "", "", err
 	}
-
-	return string(commitHash), nil
+	return refPath, strings.TrimSpace(string(commitHash)), nil
 }
 
-// Update HEAD (branch reference) to point to the new commit
-func updateHead(commitHash string) error {
-	headRef, err := os.ReadFile(".gvc/HEAD")
+// Update HEAD (the branch it points to, or HEAD itself when detached) to
+// point to the new commit, unless another process moved it away from
+// parentHash since the commit was built, and log message in the reflogs
+func (r *Repo) updateHead(commitHash, parentHash, message string) error {
+	refPath, _, err := r.readHead()
 	if err != nil {
 		return err
 	}
-
-	refPath := string(headRef)[5:] // Extract "refs/heads/main"
-	return os.WriteFile(filepath.Join(".gvc", refPath), []byte(commitHash), 0644)
+	target := refPath
+	if target == "" {
+		target = "HEAD"
+	}
+	if err := r.updateRef(target, commitHash, parentHash); err != nil {
+		return err
+	}
+	return r.logHeadMove(refPath, parentHash, commitHash, message)
 }
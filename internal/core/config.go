@@ -0,0 +1,174 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const configFile = "config"
+
+// Config is a git-style configuration file. Keys are addressed as
+// "section.key" or "section.subsection.key", e.g. "core.repositoryformatversion"
+// or "branch.main.remote". Section and key names are case-insensitive.
+type Config struct {
+	entries []configEntry
+}
+
+type configEntry struct {
+	section    string
+	subsection string
+	key        string
+	value      string
+}
+
+// ParseConfig reads a configuration in git's INI-like format.
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	var section, subsection string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.LastIndex(line, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("config line %d: missing ']'", lineNo)
+			}
+			header := strings.TrimSpace(line[1:end])
+			section, subsection = header, ""
+			if i := strings.IndexByte(header, ' '); i >= 0 {
+				section = header[:i]
+				subsection = strings.Trim(strings.TrimSpace(header[i+1:]), `"`)
+			}
+			section = strings.ToLower(section)
+			continue
+		}
+		if section == "" {
+			return nil, fmt.Errorf("config line %d: key outside of a section", lineNo)
+		}
+		key, value, found := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !found {
+			value = "true" // A bare key is a boolean true, as in git
+		}
+		cfg.entries = append(cfg.entries, configEntry{
+			section:    section,
+			subsection: subsection,
+			key:        key,
+			value:      strings.Trim(strings.TrimSpace(value), `"`),
+		})
+	}
+	return cfg, scanner.Err()
+}
+
+// Bytes serializes the configuration, grouping keys under their section.
+func (c *Config) Bytes() []byte {
+	var buf bytes.Buffer
+	var section, subsection string
+	for i, entry := range c.entries {
+		if i == 0 || entry.section != section || entry.subsection != subsection {
+			section, subsection = entry.section, entry.subsection
+			if subsection != "" {
+				fmt.Fprintf(&buf, "[%s \"%s\"]\n", section, subsection)
+			} else {
+				fmt.Fprintf(&buf, "[%s]\n", section)
+			}
+		}
+		fmt.Fprintf(&buf, "\t%s = %s\n", entry.key, entry.value)
+	}
+	return buf.Bytes()
+}
+
+// Get returns the last value set for key.
+func (c *Config) Get(key string) (string, bool) {
+	values := c.GetAll(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns every value of a multi-valued key in file order.
+func (c *Config) GetAll(key string) []string {
+	section, subsection, name := splitConfigKey(key)
+	var values []string
+	for _, entry := range c.entries {
+		if entry.section == section && entry.subsection == subsection && entry.key == name {
+			values = append(values, entry.value)
+		}
+	}
+	return values
+}
+
+// Set replaces all values of key with value.
+func (c *Config) Set(key, value string) {
+	c.Unset(key)
+	c.Add(key, value)
+}
+
+// Add appends a value to key, keeping existing values.
+func (c *Config) Add(key, value string) {
+	section, subsection, name := splitConfigKey(key)
+	entry := configEntry{section: section, subsection: subsection, key: name, value: value}
+	// Keep the entry next to the rest of its section
+	at := len(c.entries)
+	for i, e := range c.entries {
+		if e.section == section && e.subsection == subsection {
+			at = i + 1
+		}
+	}
+	c.entries = append(c.entries[:at], append([]configEntry{entry}, c.entries[at:]...)...)
+}
+
+// Unset removes all values of key.
+func (c *Config) Unset(key string) {
+	section, subsection, name := splitConfigKey(key)
+	kept := c.entries[:0]
+	for _, entry := range c.entries {
+		if entry.section != section || entry.subsection != subsection || entry.key != name {
+			kept = append(kept, entry)
+		}
+	}
+	c.entries = kept
+}
+
+// Helper: Split "section.sub.key" into its parts
+func splitConfigKey(key string) (section, subsection, name string) {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first < 0 {
+		return strings.ToLower(key), "", ""
+	}
+	section = strings.ToLower(key[:first])
+	name = strings.ToLower(key[last+1:])
+	if first != last {
+		subsection = key[first+1 : last]
+	}
+	return section, subsection, name
+}
+
+// loadConfig reads .gvc/config. A missing file yields an empty configuration.
+func (r *Repo) loadConfig() error {
+	data, err := os.ReadFile(r.gvcPath(configFile))
+	if os.IsNotExist(err) {
+		r.Config = &Config{}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r.Config, err = ParseConfig(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", r.gvcPath(configFile), err)
+	}
+	return nil
+}
+
+// SaveConfig writes the repository configuration to .gvc/config.
+func (r *Repo) SaveConfig() error {
+	return writeLocked(r.gvcPath(configFile), r.Config.Bytes(), 0644)
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+// Deltas use git's pack delta format: the source and target sizes as
+// varints, followed by "copy from source" and "insert literal" instructions.
+
+const (
+	deltaBlockSize = 16       // Bytes hashed when searching for matches
+	maxCopySize    = 0xffffff // Largest size a single copy instruction encodes
+	maxInsertSize  = 0x7f     // Largest literal a single insert instruction holds
+)
+
+var errInvalidDelta = errors.New("invalid delta")
+
+// computeDelta returns a delta that rebuilds target from source.
+func computeDelta(source, target []byte) []byte {
+	var delta bytes.Buffer
+	delta.Write(encodeDeltaSize(len(source)))
+	delta.Write(encodeDeltaSize(len(target)))
+
+	// Index the start of every source block
+	blocks := make(map[uint64]int)
+	for i := 0; i+deltaBlockSize <= len(source); i += deltaBlockSize {
+		h := blockHash(source[i : i+deltaBlockSize])
+		if _, exists := blocks[h]; !exists {
+			blocks[h] = i
+		}
+	}
+
+	var literal []byte
+	flushLiteral := func() {
+		for len(literal) > 0 {
+			n := min(len(literal), maxInsertSize)
+			delta.WriteByte(byte(n))
+			delta.Write(literal[:n])
+			literal = literal[n:]
+		}
+	}
+
+	for i := 0; i < len(target); {
+		if i+deltaBlockSize <= len(target) {
+			if offset, ok := blocks[blockHash(target[i:i+deltaBlockSize])]; ok &&
+				bytes.Equal(source[offset:offset+deltaBlockSize], target[i:i+deltaBlockSize]) {
+				length := deltaBlockSize
+				for offset+length < len(source) && i+length < len(target) && length < maxCopySize &&
+					source[offset+length] == target[i+length] {
+					length++
+				}
+				flushLiteral()
+				delta.Write(encodeCopy(offset, length))
+				i += length
+				continue
+			}
+		}
+		literal = append(literal, target[i])
+		i++
+	}
+	flushLiteral()
+	return delta.Bytes()
+}
+
+// applyDelta rebuilds the target of a delta from its source.
+func applyDelta(source, delta []byte) ([]byte, error) {
+	sourceSize, n := decodeDeltaSize(delta)
+	if n == 0 || sourceSize != len(source) {
+		return nil, errInvalidDelta
+	}
+	delta = delta[n:]
+	targetSize, n := decodeDeltaSize(delta)
+	if n == 0 {
+		return nil, errInvalidDelta
+	}
+	delta = delta[n:]
+
+	target := make([]byte, 0, targetSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// Copy: the low 4 bits select offset bytes, the next 3 select size bytes
+			var offset, size int
+			for bit := 0; bit < 7; bit++ {
+				if op&(1<<bit) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errInvalidDelta
+				}
+				if bit < 4 {
+					offset |= int(delta[0]) << (8 * bit)
+				} else {
+					size |= int(delta[0]) << (8 * (bit - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(source) {
+				return nil, errInvalidDelta
+			}
+			target = append(target, source[offset:offset+size]...)
+		case op != 0:
+			// Insert: op is the number of literal bytes that follow
+			if int(op) > len(delta) {
+				return nil, errInvalidDelta
+			}
+			target = append(target, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errInvalidDelta
+		}
+	}
+	if len(target) != targetSize {
+		return nil, errInvalidDelta
+	}
+	return target, nil
+}
+
+// Helper: Encode a copy instruction, omitting zero bytes of offset and size
+func encodeCopy(offset, size int) []byte {
+	op := byte(0x80)
+	var args []byte
+	for bit := 0; bit < 4; bit++ {
+		if b := byte(offset >> (8 * bit)); b != 0 {
+			op |= 1 << bit
+			args = append(args, b)
+		}
+	}
+	for bit := 0; bit < 3; bit++ {
+		if b := byte(size >> (8 * bit)); b != 0 {
+			op |= 1 << (4 + bit)
+			args = append(args, b)
+		}
+	}
+	return append([]byte{op}, args...)
+}
+
+// Helper: Little-endian base-128 varint used for delta header sizes
+func encodeDeltaSize(size int) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(size))
+	return buf[:n]
+}
+
+func decodeDeltaSize(data []byte) (int, int) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0
+	}
+	return int(size), n
+}
+
+func blockHash(block []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(block)
+	return h.Sum64()
+}
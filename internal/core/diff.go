@@ -1,48 +1,360 @@
 package core
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 
-	"github.com/fatih/color"
 	"github.com/pmezard/go-difflib/difflib"
 )
 
-// Computes and logs the difference between the working directory and the staging area
-func Diff() error {
-	index, err := LoadIndex()
+// FileDiff describes how a file differs between two versions: the index and
+// the working directory, a commit and the working directory, or two commits.
+type FileDiff struct {
+	Path    string
+	Status  string // "added", "modified" or "deleted"
+	Patch   string // Unified diff, empty for mode changes and files deleted from the working directory
+	OldMode string // Mode in the older version, set with NewMode when the mode changed
+	NewMode string // Mode in the newer version
+}
+
+// Files larger than core.bigFileThreshold (defaultBigFileThreshold unless
+// configured), or with a NUL byte in their first binaryCheckSize bytes, are
+// reported as binary instead of diffed line by line. Both sides of a line diff
+// are held in memory several times over, so the threshold bounds diff's memory
+// use.
+const (
+	defaultBigFileThreshold = 4 << 20
+	binaryCheckSize         = 8000
+)
+
+// Computes the difference between the working directory and the staging area
+func (r *Repo) Diff() ([]FileDiff, error) {
+	index, err := r.LoadIndex()
 	if err != nil {
-		return fmt.Errorf("failed to load index: %v", err)
+		return nil, fmt.Errorf("failed to load index: %w", err)
 	}
-	wdMap, err := ScanWorkingDir()
+	wdMap, err := r.ScanWorkingDir()
 	if err != nil {
-		return fmt.Errorf("failed to scan working directory: %v", err)
+		return nil, fmt.Errorf("failed to scan working directory: %v", err)
 	}
 
+	attrs, err := r.loadAttributes()
+	if err != nil {
+		return nil, err
+	}
+	var diffs []FileDiff
 	for _, entry := range *index {
-		currentHash, exists := wdMap[entry.Path]
+		current, exists := wdMap[entry.Path]
 		if !exists {
-			fmt.Printf("deleted: %s\n", entry.Path)
+			diffs = append(diffs, FileDiff{Path: entry.Path, Status: "deleted"})
+			continue
+		}
+		if current.Hash == entry.BlobHash && current.Mode == entry.Type {
 			continue
 		}
-		if currentHash != entry.BlobHash {
-			currentContent, err := os.ReadFile(entry.Path)
+		diff := FileDiff{Path: entry.Path, Status: "modified"}
+		if current.Mode != entry.Type {
+			diff.OldMode, diff.NewMode = entry.Type, current.Mode
+		}
+		if current.Hash != entry.BlobHash {
+			diff.Patch, err = r.diffWorkFile(entry.Path, entry.BlobHash, current.Mode == modeSymlink, matchesAnyPattern(attrs.lfs, entry.Path))
 			if err != nil {
-				return fmt.Errorf("failed to read file: %v", err)
+				return nil, err
 			}
-			stagedContent, err := ReadBlobData(entry.BlobHash)
-			if err != nil {
-				return fmt.Errorf("failed to read blob data: %v", err)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// DiffWorkTree computes the differences between the commit rev names and
+// the tracked files in the working directory.
+func (r *Repo) DiffWorkTree(rev string) ([]FileDiff, error) {
+	treeFiles, err := r.revisionFiles(rev)
+	if err != nil {
+		return nil, err
+	}
+	index, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	wdMap, err := r.ScanWorkingDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan working directory: %v", err)
+	}
+	attrs, err := r.loadAttributes()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool, len(treeFiles))
+	for path := range treeFiles {
+		paths[path] = true
+	}
+	for _, entry := range *index {
+		paths[entry.Path] = true
+	}
+	var diffs []FileDiff
+	for _, path := range sortedKeys(paths) {
+		entry, inTree := treeFiles[path]
+		current, exists := wdMap[path]
+		diff := FileDiff{Path: path, Status: "modified"}
+		switch {
+		case !exists:
+			// Files staged and deleted again never were in either
+			if inTree {
+				diffs = append(diffs, FileDiff{Path: path, Status: "deleted"})
 			}
-			diffs, err := ComputeDiff(string(currentContent), string(stagedContent), entry.Path)
+			continue
+		case !inTree:
+			diff.Status = "added"
+		case current.Hash == entry.Hash && current.Mode == entry.Mode:
+			continue
+		case current.Mode != entry.Mode:
+			diff.OldMode, diff.NewMode = entry.Mode, current.Mode
+		}
+		if current.Hash != entry.Hash {
+			diff.Patch, err = r.diffWorkFile(path, entry.Hash, current.Mode == modeSymlink, matchesAnyPattern(attrs.lfs, path))
 			if err != nil {
-				return fmt.Errorf("failed to compute diff: %v", err)
+				return nil, err
 			}
-			fmt.Print(diffs)
 		}
+		diffs = append(diffs, diff)
 	}
-	return nil
+	return diffs, nil
+}
+
+// DiffRevisions computes the differences between the commits (or trees)
+// from and to name. An empty from compares with nothing, as for a first
+// commit.
+func (r *Repo) DiffRevisions(from, to string) ([]FileDiff, error) {
+	oldFiles, err := r.revisionFiles(from)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := r.revisionFiles(to)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool, len(newFiles))
+	for path := range oldFiles {
+		paths[path] = true
+	}
+	for path := range newFiles {
+		paths[path] = true
+	}
+	var diffs []FileDiff
+	for _, path := range sortedKeys(paths) {
+		oldEntry, inOld := oldFiles[path]
+		newEntry, inNew := newFiles[path]
+		diff := FileDiff{Path: path, Status: "modified"}
+		switch {
+		case !inOld:
+			diff.Status = "added"
+		case !inNew:
+			diff.Status = "deleted"
+		case oldEntry.Hash == newEntry.Hash && oldEntry.Mode == newEntry.Mode:
+			continue
+		case oldEntry.Mode != newEntry.Mode:
+			diff.OldMode, diff.NewMode = oldEntry.Mode, newEntry.Mode
+		}
+		if oldEntry.Hash != newEntry.Hash {
+			if diff.Patch, err = r.diffBlobs(path, oldEntry.Hash, newEntry.Hash); err != nil {
+				return nil, err
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// DiffRange computes the differences between rng.From and rng.To, or for a
+// symmetric range between the last commit they share and rng.To.
+func (r *Repo) DiffRange(rng RevisionRange) ([]FileDiff, error) {
+	if !rng.Symmetric {
+		return r.DiffRevisions(rng.From, rng.To)
+	}
+	from, err := r.ResolveCommit(rng.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.ResolveCommit(rng.To)
+	if err != nil {
+		return nil, err
+	}
+	base, err := r.mergeBase(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return r.DiffRevisions(base, to)
+}
+
+// Helper: The files of the tree rev names, or of a commit's tree; none for
+// an empty rev
+func (r *Repo) revisionFiles(rev string) (map[string]TreeEntry, error) {
+	if rev == "" {
+		return map[string]TreeEntry{}, nil
+	}
+	hash, _, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := r.peelTo(hash, "tree", rev)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetTreeEntries(tree)
+}
+
+// Helper: Diff two file objects, either of which may be empty for a file
+// that does not exist. Binary and oversized files are only compared by hash.
+func (r *Repo) diffBlobs(path, oldHash, newHash string) (string, error) {
+	oldBlob, oldSize, err := r.openFileObject(oldHash)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob data: %v", err)
+	}
+	defer oldBlob.Close()
+	newBlob, newSize, err := r.openFileObject(newHash)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob data: %v", err)
+	}
+	defer newBlob.Close()
+
+	older := bufio.NewReaderSize(oldBlob, binaryCheckSize)
+	newer := bufio.NewReaderSize(newBlob, binaryCheckSize)
+	threshold := r.bigFileThreshold()
+	if oldSize > threshold || newSize > threshold || isBinary(older) || isBinary(newer) {
+		return fmt.Sprintf("Binary files a/%s and b/%s differ\n", path, path), nil
+	}
+	oldContent, err := io.ReadAll(older)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob data: %v", err)
+	}
+	newContent, err := io.ReadAll(newer)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob data: %v", err)
+	}
+	patch, err := ComputeDiff(string(newContent), string(oldContent), path)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute diff: %v", err)
+	}
+	return patch, nil
+}
+
+// Helper: OpenBlob, with an empty hash standing for an empty file
+func (r *Repo) openFileObject(hash string) (io.ReadCloser, int64, error) {
+	if hash == "" {
+		return io.NopCloser(strings.NewReader("")), 0, nil
+	}
+	return r.OpenBlob(hash)
+}
+
+// Helper: Diff a work tree file against a blob, its staged one or that of a
+// commit, with an empty blobHash for a file that did not exist. Binary and oversized
+// files are only compared by hash; LFS files are compared by pointer and
+// symlinks by target.
+func (r *Repo) diffWorkFile(path, blobHash string, symlink, lfs bool) (string, error) {
+	if symlink {
+		target, err := os.Readlink(r.workPath(path))
+		if err != nil {
+			return "", fmt.Errorf("failed to read link: %v", err)
+		}
+		staged, err := r.readFileObject(blobHash)
+		if err != nil {
+			return "", fmt.Errorf("failed to read blob data: %v", err)
+		}
+		return ComputeDiff(target, string(staged), path)
+	}
+	if lfs {
+		pointer, err := lfsPointerForFile(r.workPath(path))
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %v", err)
+		}
+		staged, err := r.readFileObject(blobHash)
+		if err != nil {
+			return "", fmt.Errorf("failed to read blob data: %v", err)
+		}
+		return ComputeDiff(string(pointer.Bytes()), string(staged), path)
+	}
+
+	file, err := os.Open(r.workPath(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	blob, blobSize, err := r.openFileObject(blobHash)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob data: %v", err)
+	}
+	defer blob.Close()
+
+	current := bufio.NewReaderSize(file, binaryCheckSize)
+	staged := bufio.NewReaderSize(blob, binaryCheckSize)
+	threshold := r.bigFileThreshold()
+	if info.Size() > threshold || blobSize > threshold || isBinary(current) || isBinary(staged) {
+		return fmt.Sprintf("Binary files a/%s and b/%s differ\n", path, path), nil
+	}
+	currentContent, err := io.ReadAll(current)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+	stagedContent, err := io.ReadAll(staged)
+	if err != nil {
+		return "", fmt.Errorf("failed to read blob data: %v", err)
+	}
+	patch, err := ComputeDiff(string(currentContent), string(stagedContent), path)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute diff: %v", err)
+	}
+	return patch, nil
+}
+
+// Helper: ReadBlobData, with an empty hash standing for an empty file
+func (r *Repo) readFileObject(hash string) ([]byte, error) {
+	if hash == "" {
+		return nil, nil
+	}
+	return r.ReadBlobData(hash)
+}
+
+// Helper: Size above which files are not diffed, core.bigFileThreshold in
+// bytes with an optional k, m or g suffix
+func (r *Repo) bigFileThreshold() int64 {
+	value, ok := r.Config.Get("core.bigfilethreshold")
+	if !ok {
+		return defaultBigFileThreshold
+	}
+	value = strings.ToLower(strings.TrimSpace(value))
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(value, "k"):
+		unit = 1 << 10
+	case strings.HasSuffix(value, "m"):
+		unit = 1 << 20
+	case strings.HasSuffix(value, "g"):
+		unit = 1 << 30
+	}
+	n, err := strconv.ParseInt(strings.TrimRight(value, "kmg"), 10, 64)
+	if err != nil || n < 0 {
+		return defaultBigFileThreshold
+	}
+	return n * unit
+}
+
+// Helper: Reports whether the start of r contains a NUL byte, git's binary test
+func isBinary(r *bufio.Reader) bool {
+	head, _ := r.Peek(binaryCheckSize)
+	return bytes.IndexByte(head, 0) >= 0
 }
 
 func ComputeDiff(current, staged, path string) (string, error) {
@@ -58,34 +370,5 @@ func ComputeDiff(current, staged, path string) (string, error) {
 		Context:  3,    // Number of context lines
 	}
 
-	diffText, err := difflib.GetUnifiedDiffString(diff)
-	if err != nil {
-		return "", err
-	}
-	coloredDiff := colorizeDiff(diffText)
-	return coloredDiff, nil
-}
-
-func colorizeDiff(diffText string) string {
-	var sb strings.Builder
-	red := color.New(color.FgRed).SprintFunc()
-	green := color.New(color.FgGreen).SprintFunc()
-	blue := color.New(color.FgBlue).SprintFunc()
-
-	lines := strings.Split(diffText, "\n")
-	for _, line := range lines {
-		// Do not colorize diff headers.
-		if strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") {
-			sb.WriteString(line + "\n")
-		} else if strings.HasPrefix(line, "@@"){
-			sb.WriteString(blue(line) + "\n")
-		} else if strings.HasPrefix(line, "-") {
-			sb.WriteString(red(line) + "\n")
-		} else if strings.HasPrefix(line, "+") {
-			sb.WriteString(green(line) + "\n")
-		} else {
-			sb.WriteString(line + "\n")
-		}
-	}
-	return sb.String()
+	return difflib.GetUnifiedDiffString(diff)
 }
@@ -0,0 +1,431 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore is the on-disk ObjectStore in .gvc/objects: loose objects in
+// ab/cdef... files plus git-style packs in pack/.
+type FileStore struct {
+	dir      string
+	format   *ObjectFormat
+	compress bool // Write loose objects zlib-deflated (format version 1)
+
+	packsMu sync.Mutex
+	packs   []*packFile // Loaded lazily by loadPacks
+}
+
+// NewFileStore returns a store for the objects directory dir holding objects
+// named in format. With compress set new loose objects are zlib-deflated,
+// otherwise they are stored as is.
+func NewFileStore(dir string, format *ObjectFormat, compress bool) *FileStore {
+	return &FileStore{dir: dir, format: format, compress: compress}
+}
+
+func (s *FileStore) Has(hash string) (bool, error) {
+	if len(hash) < 3 {
+		return false, nil
+	}
+	if _, err := os.Stat(s.loosePath(hash)); err == nil {
+		return true, nil
+	}
+	packs, err := s.loadPacks()
+	if err != nil {
+		return false, err
+	}
+	for _, pack := range packs {
+		if _, ok := pack.find(hash); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Helper: Reset the mtime of the loose object hash to now, reporting whether
+// it exists. Writers call this instead of skipping an object they already
+// have, so that prune's grace period protects it until a ref or the index
+// points at it, as git does.
+func (s *FileStore) freshen(hash string) bool {
+	now := time.Now()
+	return len(hash) >= 3 && os.Chtimes(s.loosePath(hash), now, now) == nil
+}
+
+// Get looks hash up as a loose object first, then in the packs.
+func (s *FileStore) Get(hash string) ([]byte, error) {
+	if len(hash) < 3 {
+		return nil, fmt.Errorf("invalid object name '%s'", hash)
+	}
+	data, err := s.readLoose(hash)
+	if !os.IsNotExist(err) {
+		return data, err
+	}
+	packs, err := s.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, pack := range packs {
+		if offset, ok := pack.find(hash); ok {
+			return pack.readObject(offset)
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", hash, ErrObjectNotFound)
+}
+
+// Put writes a loose object.
+func (s *FileStore) Put(hash string, data []byte) error {
+	objectPath := s.loosePath(hash)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return err
+	}
+	if s.compress {
+		compressed, err := compressObject(data)
+		if err != nil {
+			return err
+		}
+		data = compressed
+	}
+	return writeFileAtomic(objectPath, data, 0644)
+}
+
+// PutStream reads size bytes of content from src and stores them as a loose
+// object of objType. The object is hashed while it is written to a temporary
+// file, which is then renamed into place.
+func (s *FileStore) PutStream(objType string, size int64, src io.Reader) (string, error) {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-obj-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	defer tmp.Close()
+
+	var w io.Writer = tmp
+	var zw *zlib.Writer
+	if s.compress {
+		zw = zlib.NewWriter(tmp)
+		w = zw
+	}
+	h := s.format.New()
+	w = io.MultiWriter(w, h)
+	if _, err := fmt.Fprintf(w, "%s %d\x00", objType, size); err != nil {
+		return "", err
+	}
+	n, err := io.Copy(w, io.LimitReader(src, size+1))
+	if err != nil {
+		return "", err
+	}
+	if n != size {
+		return "", fmt.Errorf("expected %d bytes of content, got %d (was the file modified while reading?)", size, n)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	if s.freshen(hash) {
+		return hash, nil // Objects are immutable, keep the existing copy
+	}
+	if ok, err := s.Has(hash); err == nil && ok {
+		return hash, nil // Packed, and prune only deletes loose objects
+	}
+	objectPath := s.loosePath(hash)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	return hash, os.Rename(tmp.Name(), objectPath)
+}
+
+// Open streams the content of an object. Only deltified packed objects are
+// read into memory.
+func (s *FileStore) Open(hash string) (string, int64, io.ReadCloser, error) {
+	if len(hash) < 3 {
+		return "", 0, nil, fmt.Errorf("invalid object name '%s'", hash)
+	}
+	f, err := os.Open(s.loosePath(hash))
+	if err == nil {
+		return openLoose(f)
+	}
+	if !os.IsNotExist(err) {
+		return "", 0, nil, err
+	}
+	packs, err := s.loadPacks()
+	if err != nil {
+		return "", 0, nil, err
+	}
+	for _, pack := range packs {
+		if offset, ok := pack.find(hash); ok {
+			return pack.openObject(offset)
+		}
+	}
+	return "", 0, nil, fmt.Errorf("%s: %w", hash, ErrObjectNotFound)
+}
+
+// Iterate visits every loose object, then every packed object not also
+// stored loose.
+func (s *FileStore) Iterate(fn func(hash string) error) error {
+	loose, err := s.looseObjects()
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(loose))
+	for _, hash := range loose {
+		seen[hash] = true
+		if err := fn(hash); err != nil {
+			return err
+		}
+	}
+	packs, err := s.loadPacks()
+	if err != nil {
+		return err
+	}
+	for _, pack := range packs {
+		for _, hash := range pack.names() {
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			if err := fn(hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Delete removes a loose object and its fan-out directory once empty.
+func (s *FileStore) Delete(hash string) error {
+	objectPath := s.loosePath(hash)
+	if err := os.Remove(objectPath); err != nil {
+		return err
+	}
+	os.Remove(filepath.Dir(objectPath)) // Only succeeds once the directory is empty
+	return nil
+}
+
+func (s *FileStore) loosePath(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash[2:])
+}
+
+// Helper: Read and inflate a loose object
+func (s *FileStore) readLoose(hash string) ([]byte, error) {
+	data, err := os.ReadFile(s.loosePath(hash))
+	if err != nil {
+		return nil, err
+	}
+	if !isZlibCompressed(data) {
+		return data, nil // Written by a format version 0 repository
+	}
+	return decompressObject(data)
+}
+
+// Helper: Stream a loose object file, inflating it if needed, positioned
+// after the header
+func openLoose(f *os.File) (string, int64, io.ReadCloser, error) {
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	closeFn := f.Close
+	if head, _ := br.Peek(2); isZlibCompressed(head) {
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			f.Close()
+			return "", 0, nil, fmt.Errorf("failed to inflate object: %v", err)
+		}
+		r = zr
+		closeFn = func() error {
+			zr.Close()
+			return f.Close()
+		}
+	}
+	content := bufio.NewReader(r)
+	header, err := content.ReadString(0)
+	typ, sizeField, found := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	size, sizeErr := strconv.ParseInt(sizeField, 10, 64)
+	if err != nil || !found || sizeErr != nil {
+		closeFn()
+		return "", 0, nil, fmt.Errorf("%s: invalid object header", f.Name())
+	}
+	return typ, size, &readCloser{Reader: io.LimitReader(content, size), close: closeFn}, nil
+}
+
+// readCloser pairs a reader with the function releasing what it reads from.
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc *readCloser) Close() error {
+	return rc.close()
+}
+
+// looseObjects returns the hashes of all loose objects.
+func (s *FileStore) looseObjects() ([]string, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(s.dir, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.Name()[0] != '.' {
+				hashes = append(hashes, dir.Name()+file.Name())
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// findPrefix returns the objects whose hash starts with prefix, which must
+// be at least two hex digits: the loose objects in its fan-out directory and
+// the packed objects found by binary search.
+func (s *FileStore) findPrefix(prefix string) ([]string, error) {
+	found := make(map[string]bool)
+	files, err := os.ReadDir(filepath.Join(s.dir, prefix[:2]))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, file := range files {
+		if hash := prefix[:2] + file.Name(); file.Name()[0] != '.' && strings.HasPrefix(hash, prefix) {
+			found[hash] = true
+		}
+	}
+	packs, err := s.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, pack := range packs {
+		for _, hash := range pack.findPrefix(prefix) {
+			found[hash] = true
+		}
+	}
+	return sortedKeys(found), nil
+}
+
+// migrate compresses every uncompressed loose object and switches the store
+// to writing compressed objects. It returns the number of objects rewritten.
+func (s *FileStore) migrate() (int, error) {
+	loose, err := s.looseObjects()
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, hash := range loose {
+		objectPath := s.loosePath(hash)
+		data, err := os.ReadFile(objectPath)
+		if err != nil {
+			return migrated, err
+		}
+		if isZlibCompressed(data) {
+			continue
+		}
+		compressed, err := compressObject(data)
+		if err != nil {
+			return migrated, err
+		}
+		if err := writeFileAtomic(objectPath, compressed, 0644); err != nil {
+			return migrated, fmt.Errorf("failed to rewrite %s: %v", objectPath, err)
+		}
+		migrated++
+	}
+	s.compress = true
+	return migrated, nil
+}
+
+// loadPacks opens every pack index in the pack directory.
+func (s *FileStore) loadPacks() ([]*packFile, error) {
+	s.packsMu.Lock()
+	defer s.packsMu.Unlock()
+	if s.packs != nil {
+		return s.packs, nil
+	}
+	idxPaths, err := filepath.Glob(filepath.Join(s.dir, "pack", "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	packs := []*packFile{}
+	for _, idxPath := range idxPaths {
+		pack, err := readPackIndex(idxPath, s.format.Size)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	s.packs = packs
+	return packs, nil
+}
+
+// Helper: Forget loaded packs so the next lookup rescans the directory
+func (s *FileStore) reloadPacks() {
+	s.packsMu.Lock()
+	s.packs = nil
+	s.packsMu.Unlock()
+}
+
+// Helper: Remove a pack and its index
+func (s *FileStore) removePack(pack *packFile) error {
+	if err := os.Remove(pack.packPath); err != nil {
+		return err
+	}
+	idxPath := strings.TrimSuffix(pack.packPath, ".pack") + ".idx"
+	if err := os.Remove(idxPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Helper: Deflate object data with zlib, as git stores loose objects
+func compressObject(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Helper: Inflate a zlib-compressed object
+func decompressObject(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inflate object: %v", err)
+	}
+	defer zr.Close()
+	inflated, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inflate object: %v", err)
+	}
+	return inflated, nil
+}
+
+// Helper: Reports whether data starts with a zlib header. Uncompressed objects
+// start with their ASCII type name, which never forms a valid zlib header.
+func isZlibCompressed(data []byte) bool {
+	return len(data) >= 2 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0
+}
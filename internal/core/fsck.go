@@ -0,0 +1,304 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of problems reported by Fsck.
+const (
+	FsckCorrupt  = "corrupt"  // Unreadable object, bad header, hash mismatch or malformed content
+	FsckMissing  = "missing"  // Referenced by an object, ref or the index but not stored
+	FsckBadRef   = "bad-ref"  // A ref, HEAD or index entry that is malformed or has the wrong type
+	FsckDangling = "dangling" // Stored but not referenced by anything
+)
+
+// FsckProblem is a single finding of Fsck.
+type FsckProblem struct {
+	Kind    string
+	Type    string // Object type, if known
+	Hash    string // Object or ref the problem is about
+	Message string
+}
+
+func (p FsckProblem) String() string {
+	switch p.Kind {
+	case FsckDangling:
+		return fmt.Sprintf("dangling %s %s", p.Type, p.Hash)
+	case FsckMissing:
+		return fmt.Sprintf("missing %s %s (%s)", p.Type, p.Hash, p.Message)
+	}
+	return fmt.Sprintf("error: %s: %s", p.Hash, p.Message)
+}
+
+// FsckReport is the result of Fsck.
+type FsckReport struct {
+	Objects  int // Number of objects checked
+	Problems []FsckProblem
+}
+
+// HasErrors reports whether there are problems other than dangling objects.
+func (f *FsckReport) HasErrors() bool {
+	for _, problem := range f.Problems {
+		if problem.Kind != FsckDangling {
+			return true
+		}
+	}
+	return false
+}
+
+// objectLink is a reference from one object (or ref) to another.
+type objectLink struct {
+	from     string
+	to       string
+	wantType string
+}
+
+// Fsck verifies every loose and packed object and every ref: objects must
+// hash to their name, have a correct header and parse, and everything they
+// reference must exist with the expected type.
+func (r *Repo) Fsck() (*FsckReport, error) {
+	report := &FsckReport{}
+	types := make(map[string]string)
+	var links []objectLink
+
+	check := func(hash string, data []byte, readErr error) {
+		report.Objects++
+		if readErr != nil {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckCorrupt, Hash: hash, Message: readErr.Error()})
+			return
+		}
+		typ, objectLinks, err := verifyObject(r.Format, hash, data)
+		if err != nil {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckCorrupt, Type: typ, Hash: hash, Message: err.Error()})
+			return
+		}
+		types[hash] = typ
+		links = append(links, objectLinks...)
+	}
+
+	err := r.Objects.Iterate(func(hash string) error {
+		data, err := r.Objects.Get(hash)
+		check(hash, data, err)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if store, err := r.fileStore(); err == nil {
+		packs, err := store.loadPacks()
+		if err != nil {
+			return nil, err
+		}
+		for _, pack := range packs {
+			if err := verifyPackChecksums(pack, r.Format); err != nil {
+				report.Problems = append(report.Problems, FsckProblem{Kind: FsckCorrupt, Hash: pack.packPath, Message: err.Error()})
+			}
+		}
+	}
+
+	// Refs, HEAD, the reflogs and the index are roots: they are checked like
+	// links but never make an object dangling.
+	var roots []objectLink
+	refs, err := r.ListRefs()
+	if err != nil {
+		return nil, err
+	}
+	for name, hash := range refs {
+		if err := checkHash(r.Format, hash); err != nil {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckBadRef, Hash: name, Message: err.Error()})
+			continue
+		}
+		// Tags may point at any object, branches only at commits
+		wantType := "commit"
+		if strings.HasPrefix(name, "refs/tags/") {
+			wantType = ""
+		}
+		roots = append(roots, objectLink{from: name, to: hash, wantType: wantType})
+	}
+	head, err := os.ReadFile(r.gvcPath("HEAD"))
+	if err != nil {
+		return nil, err
+	}
+	// A detached HEAD holds a commit hash, which keeps its history alive
+	if detached := strings.TrimSpace(string(head)); r.Format.IsValidHash(detached) {
+		roots = append(roots, objectLink{from: "HEAD", to: detached, wantType: "commit"})
+	} else if !strings.HasPrefix(string(head), "ref: refs/") {
+		report.Problems = append(report.Problems, FsckProblem{Kind: FsckBadRef, Hash: "HEAD", Message: "HEAD is neither a symbolic ref nor a commit hash"})
+	}
+	reflogs, err := r.reflogLinks()
+	if err != nil {
+		report.Problems = append(report.Problems, FsckProblem{Kind: FsckBadRef, Hash: "reflog", Message: err.Error()})
+	}
+	roots = append(roots, reflogs...)
+	index, err := r.LoadIndex()
+	if err != nil {
+		report.Problems = append(report.Problems, FsckProblem{Kind: FsckBadRef, Hash: "index", Message: err.Error()})
+		index = &Index{}
+	}
+	for _, entry := range *index {
+		roots = append(roots, objectLink{from: "index entry " + entry.Path, to: entry.BlobHash, wantType: entry.ObjectType()})
+	}
+
+	referenced := make(map[string]bool)
+	for _, link := range append(links, roots...) {
+		referenced[link.to] = true
+		typ, exists := types[link.to]
+		switch {
+		case !exists && r.HasObject(link.to):
+			// Stored but corrupt, already reported
+		case !exists:
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind: FsckMissing, Type: link.wantType, Hash: link.to,
+				Message: "referenced by " + link.from,
+			})
+		case link.wantType != "" && typ != link.wantType:
+			report.Problems = append(report.Problems, FsckProblem{
+				Kind: FsckBadRef, Type: typ, Hash: link.from,
+				Message: fmt.Sprintf("points to %s %s, expected a %s", typ, link.to, link.wantType),
+			})
+		}
+	}
+	for hash, typ := range types {
+		if !referenced[hash] {
+			report.Problems = append(report.Problems, FsckProblem{Kind: FsckDangling, Type: typ, Hash: hash})
+		}
+	}
+
+	sort.Slice(report.Problems, func(i, j int) bool {
+		a, b := report.Problems[i], report.Problems[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Hash < b.Hash
+	})
+	return report, nil
+}
+
+// Helper: Check an object's header, hash and content, returning its type and
+// the objects it references
+func verifyObject(format *ObjectFormat, hash string, data []byte) (string, []objectLink, error) {
+	if err := checkHash(format, hash); err != nil {
+		return "", nil, err
+	}
+	nul := bytes.IndexByte(data, 0)
+	if nul < 0 {
+		return "", nil, fmt.Errorf("missing object header")
+	}
+	typ, sizeField, found := strings.Cut(string(data[:nul]), " ")
+	if !found {
+		return "", nil, fmt.Errorf("malformed object header %q", data[:nul])
+	}
+	content := data[nul+1:]
+	size, err := strconv.Atoi(sizeField)
+	if err != nil || size != len(content) {
+		return typ, nil, fmt.Errorf("header size %s does not match content size %d", sizeField, len(content))
+	}
+	if actual, _ := format.ObjectData(typ, content); actual != hash {
+		return typ, nil, fmt.Errorf("hash mismatch, content hashes to %s", actual)
+	}
+
+	var links []objectLink
+	switch typ {
+	case "blob":
+	case "tree":
+		tree, err := parseTree(hash, content)
+		if err != nil {
+			return typ, nil, err
+		}
+		for _, entry := range tree {
+			if err := checkHash(format, entry.Hash); err != nil {
+				return typ, nil, fmt.Errorf("entry %s: %v", entry.Path, err)
+			}
+			if (entry.Type == "tree") != (entry.Mode == "040000") || (entry.Type != "tree" && entry.Type != "blob" && entry.Type != "chunks") {
+				return typ, nil, fmt.Errorf("entry %s has mode %s and type %s", entry.Path, entry.Mode, entry.Type)
+			}
+			links = append(links, objectLink{from: "tree " + hash, to: entry.Hash, wantType: entry.Type})
+		}
+	case "chunks":
+		chunks, err := parseChunkList(hash, content)
+		if err != nil {
+			return typ, nil, err
+		}
+		for _, chunk := range chunks {
+			if err := checkHash(format, chunk.Hash); err != nil {
+				return typ, nil, fmt.Errorf("chunk: %v", err)
+			}
+			links = append(links, objectLink{from: "chunks " + hash, to: chunk.Hash, wantType: "blob"})
+		}
+	case "commit":
+		commit, err := parseCommit(hash, content)
+		if err != nil {
+			return typ, nil, err
+		}
+		if err := checkHash(format, commit.Tree); err != nil {
+			return typ, nil, fmt.Errorf("tree: %v", err)
+		}
+		links = append(links, objectLink{from: "commit " + hash, to: commit.Tree, wantType: "tree"})
+		if commit.Parent != "" {
+			if err := checkHash(format, commit.Parent); err != nil {
+				return typ, nil, fmt.Errorf("parent: %v", err)
+			}
+			links = append(links, objectLink{from: "commit " + hash, to: commit.Parent, wantType: "commit"})
+		}
+	case "tag":
+		tag, err := parseTag(hash, content)
+		if err != nil {
+			return typ, nil, err
+		}
+		if err := checkHash(format, tag.Object); err != nil {
+			return typ, nil, fmt.Errorf("object: %v", err)
+		}
+		links = append(links, objectLink{from: "tag " + hash, to: tag.Object, wantType: tag.Type})
+	default:
+		return typ, nil, fmt.Errorf("unknown object type '%s'", typ)
+	}
+	return typ, links, nil
+}
+
+// Helper: Verify the trailing checksums of a pack and its index
+func verifyPackChecksums(pack *packFile, format *ObjectFormat) error {
+	hashSize := format.Size
+	packData, err := os.ReadFile(pack.packPath)
+	if err != nil {
+		return err
+	}
+	idxData, err := os.ReadFile(strings.TrimSuffix(pack.packPath, ".pack") + ".idx")
+	if err != nil {
+		return err
+	}
+	if len(packData) < hashSize || len(idxData) < 2*hashSize {
+		return fmt.Errorf("truncated pack")
+	}
+	packSum := format.Sum(packData[:len(packData)-hashSize])
+	if !bytes.Equal(packSum[:], packData[len(packData)-hashSize:]) {
+		return fmt.Errorf("pack checksum mismatch")
+	}
+	if !bytes.Equal(packSum[:], idxData[len(idxData)-2*hashSize:len(idxData)-hashSize]) {
+		return fmt.Errorf("index does not belong to this pack")
+	}
+	idxSum := format.Sum(idxData[:len(idxData)-hashSize])
+	if !bytes.Equal(idxSum[:], idxData[len(idxData)-hashSize:]) {
+		return fmt.Errorf("pack index checksum mismatch")
+	}
+	return nil
+}
+
+// Helper: Check hash is a valid name in format, recognizing names of the
+// other format so that mixed-up repositories get a clear message
+func checkHash(format *ObjectFormat, hash string) error {
+	if format.IsValidHash(hash) {
+		return nil
+	}
+	for _, other := range []*ObjectFormat{SHA1, SHA256} {
+		if other != format && other.IsValidHash(hash) {
+			return fmt.Errorf("'%s' is a %s name in a %s repository", hash, other.Name, format.Name)
+		}
+	}
+	return fmt.Errorf("invalid hash '%s'", hash)
+}
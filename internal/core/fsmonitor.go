@@ -0,0 +1,220 @@
+package core
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// With core.fsmonitor set to true, a daemon (gvc fsmonitor run) watches the
+// work tree and answers which paths changed since a token over a Unix socket.
+// ScanWorkingDir keeps the result of its last scan with the token it got in
+// .gvc/fsmonitor-state, and the next scan only looks at the paths changed
+// since. The daemon is started on demand by the first scan that cannot reach
+// it, and exits when no scan asked it anything for a while.
+//
+// A token is "<instance>:<sequence>". The instance changes whenever the
+// daemon lost track of events (a new daemon, a queue overflow), so tokens of
+// an earlier instance get a "full" answer: every path may have changed.
+
+const (
+	fsmonitorSocketName = "fsmonitor.sock"
+	fsmonitorStateName  = "fsmonitor-state"
+
+	// Time a query may take, including the daemon catching up with events
+	fsmonitorTimeout = 5 * time.Second
+)
+
+// DefaultFSMonitorIdle is how long the daemon runs without being queried.
+const DefaultFSMonitorIdle = 10 * time.Minute
+
+var (
+	// ErrFSMonitorUnsupported is returned by RunFSMonitor and StartFSMonitor
+	// on platforms without a file system monitor.
+	ErrFSMonitorUnsupported = errors.New("fsmonitor is not supported on this platform")
+
+	// ErrFSMonitorRunning is returned by RunFSMonitor when a daemon already
+	// watches the repository.
+	ErrFSMonitorRunning = errors.New("fsmonitor is already running for this repository")
+)
+
+// fsmonitorRequest is sent by a client, one JSON object per connection.
+type fsmonitorRequest struct {
+	Command string // "query", "status" or "stop"
+	Token   string `json:",omitempty"`
+}
+
+// fsmonitorResponse answers a request. Paths are relative to the work tree;
+// a directory stands for everything below it.
+type fsmonitorResponse struct {
+	Token string
+	Full  bool     `json:",omitempty"`
+	Paths []string `json:",omitempty"`
+	Error string   `json:",omitempty"`
+}
+
+// fsmonitorState is the last scan, as of Token. Stamp identifies the config
+// and exclude files the scan depended on, which the daemon does not watch.
+type fsmonitorState struct {
+	Token string
+	Stamp string
+	Files map[string]WorkFile
+}
+
+// Helper: Reports whether core.fsmonitor is enabled
+func (r *Repo) fsmonitorEnabled() bool {
+	value, _ := r.Config.Get("core.fsmonitor")
+	return value == "true"
+}
+
+// Helper: Path of the daemon's socket. Socket paths are limited to about
+// 100 bytes, so deep repositories get one in the temporary directory.
+func (r *Repo) fsmonitorSocket() string {
+	socket := r.gvcPath(fsmonitorSocketName)
+	if len(socket) < 100 {
+		return socket
+	}
+	sum := sha1.Sum([]byte(r.GvcDir))
+	return filepath.Join(os.TempDir(), "gvc-fsmonitor-"+hex.EncodeToString(sum[:8])+".sock")
+}
+
+// Helper: Send a request to the daemon
+func (r *Repo) fsmonitorRequest(req fsmonitorRequest) (*fsmonitorResponse, error) {
+	conn, err := net.DialTimeout("unix", r.fsmonitorSocket(), time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(fsmonitorTimeout))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to query fsmonitor: %v", err)
+	}
+	var resp fsmonitorResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read fsmonitor answer: %v", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("fsmonitor: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+// Helper: What changed since the last scan, according to the daemon. Without
+// incremental, the caller scans the whole tree; token, if set, is what to
+// save the result of that scan with.
+func (r *Repo) fsmonitorChanges() (token string, previous map[string]WorkFile, dirty []string, incremental bool) {
+	if !r.fsmonitorEnabled() {
+		return "", nil, nil, false
+	}
+	state := r.loadFSMonitorState()
+	resp, err := r.fsmonitorRequest(fsmonitorRequest{Command: "query", Token: state.Token})
+	if err != nil {
+		// Not running: start it for the next scan, and walk the tree this time
+		r.spawnFSMonitor()
+		return "", nil, nil, false
+	}
+	if resp.Full || state.Files == nil {
+		return resp.Token, nil, nil, false
+	}
+	for _, relPath := range resp.Paths {
+		// Changed ignore rules or attributes can change any path
+		switch path.Base(relPath) {
+		case ".", IgnoreFile, AttributesFile:
+			return resp.Token, nil, nil, false
+		}
+	}
+	return resp.Token, state.Files, resp.Paths, true
+}
+
+// Helper: The saved scan, empty if there is none or it depended on config
+// or exclude files that changed since
+func (r *Repo) loadFSMonitorState() fsmonitorState {
+	var state fsmonitorState
+	data, err := os.ReadFile(r.gvcPath(fsmonitorStateName))
+	if err != nil || json.Unmarshal(data, &state) != nil || state.Stamp != r.fsmonitorStamp() {
+		return fsmonitorState{}
+	}
+	return state
+}
+
+// Helper: Save a scan made after the daemon answered with token. Like
+// refreshing the index, this is only an optimization and errors are ignored.
+func (r *Repo) saveFSMonitorState(token string, files map[string]WorkFile) {
+	data, err := json.Marshal(fsmonitorState{Token: token, Stamp: r.fsmonitorStamp(), Files: files})
+	if err != nil {
+		return
+	}
+	writeLocked(r.gvcPath(fsmonitorStateName), data, 0644)
+}
+
+// Helper: Size and modification time of the files outside the work tree that
+// a scan depends on
+func (r *Repo) fsmonitorStamp() string {
+	var stamp strings.Builder
+	for _, file := range []string{r.gvcPath(configFile), r.gvcPath("info", "exclude"), r.excludesFile()} {
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&stamp, "%d:%d;", info.Size(), info.ModTime().UnixNano())
+		} else {
+			stamp.WriteString("-;")
+		}
+	}
+	return stamp.String()
+}
+
+// FSMonitorRunning reports whether a daemon watches the repository.
+func (r *Repo) FSMonitorRunning() bool {
+	_, err := r.fsmonitorRequest(fsmonitorRequest{Command: "status"})
+	return err == nil
+}
+
+// StartFSMonitor starts the daemon in the background and waits until it
+// answers. It does nothing if the daemon is already running.
+func (r *Repo) StartFSMonitor() error {
+	if r.FSMonitorRunning() {
+		return nil
+	}
+	if err := r.spawnFSMonitor(); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(fsmonitorTimeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if r.FSMonitorRunning() {
+			return nil
+		}
+	}
+	return fmt.Errorf("fsmonitor did not start")
+}
+
+// StopFSMonitor asks the daemon to exit and waits until it stopped answering.
+// It does nothing if it is not running.
+func (r *Repo) StopFSMonitor() error {
+	if !r.FSMonitorRunning() {
+		return nil
+	}
+	if _, err := r.fsmonitorRequest(fsmonitorRequest{Command: "stop"}); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(fsmonitorTimeout); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if !r.FSMonitorRunning() {
+			return nil
+		}
+	}
+	return fmt.Errorf("fsmonitor did not stop")
+}
+
+// Helper: The gvc executable that runs the daemon: this program if it is
+// gvc, else gvc from the PATH
+func gvcExecutable() (string, error) {
+	if exe, err := os.Executable(); err == nil && strings.TrimSuffix(filepath.Base(exe), ".exe") == "gvc" {
+		return exe, nil
+	}
+	return exec.LookPath("gvc")
+}
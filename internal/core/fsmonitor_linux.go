@@ -0,0 +1,359 @@
+//go:build linux
+
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Events that change what a scan would find
+const fsmonitorMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// Past this many changed paths the daemon starts over with a new instance
+// rather than grow without bound
+const fsmonitorMaxChanged = 100000
+
+// fsmonitor is the state of a running daemon.
+type fsmonitor struct {
+	repo     *Repo
+	fd       int
+	inotify  *os.File // fd, non-blocking so closing it ends a pending read
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu        sync.Mutex
+	instance  string
+	seq       uint64
+	changed   map[string]uint64 // Sequence number of the last change of each path
+	watches   map[int32]string  // Directory, relative to the work tree, of each watch
+	gvcWatch  int32             // Watch on .gvc, only for cookies
+	unwatched bool              // A directory could not be watched, every answer is full
+	cookies   map[string]chan struct{}
+	cookieSeq int
+	lastQuery time.Time
+}
+
+// RunFSMonitor watches the work tree and answers queries on the socket until
+// StopFSMonitor is called or nobody queried it for idle.
+func (r *Repo) RunFSMonitor(idle time.Duration) error {
+	if idle <= 0 {
+		idle = DefaultFSMonitorIdle
+	}
+	// The lock is held as long as the daemon runs
+	lock, err := acquireLock(r.gvcPath("fsmonitor"))
+	if errors.Is(err, ErrLocked) {
+		return ErrFSMonitorRunning
+	} else if err != nil {
+		return err
+	}
+	defer lock.rollback()
+	socket := r.fsmonitorSocket()
+	// Left behind by a daemon that did not exit cleanly
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", socket, err)
+	}
+	defer os.Remove(socket)
+	defer listener.Close()
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed to start inotify: %v", err)
+	}
+	m := &fsmonitor{
+		repo:      r,
+		fd:        fd,
+		inotify:   os.NewFile(uintptr(fd), "inotify"),
+		stop:      make(chan struct{}),
+		changed:   make(map[string]uint64),
+		watches:   make(map[int32]string),
+		cookies:   make(map[string]chan struct{}),
+		lastQuery: time.Now(),
+	}
+	defer m.inotify.Close()
+	m.newInstance()
+	wd, err := syscall.InotifyAddWatch(m.fd, r.GvcDir, syscall.IN_CREATE)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %v", r.GvcDir, err)
+	}
+	m.gvcWatch = int32(wd)
+	if err := m.watchTree(""); err != nil {
+		return err
+	}
+
+	readErr := make(chan error, 1)
+	go func() { readErr <- m.readEvents() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+
+	// NewTicker panics on a zero interval, as idle/10 is for idle under 10ns
+	ticker := time.NewTicker(max(idle/10, 100*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return nil
+		case err := <-readErr:
+			return err
+		case <-ticker.C:
+			m.mu.Lock()
+			idleFor := time.Since(m.lastQuery)
+			m.mu.Unlock()
+			if idleFor >= idle {
+				return nil
+			}
+		}
+	}
+}
+
+// Helper: Start over with a new instance, so all older tokens get full answers
+func (m *fsmonitor) newInstance() {
+	id := make([]byte, 8)
+	rand.Read(id)
+	m.instance = hex.EncodeToString(id)
+	m.seq = 0
+	m.changed = make(map[string]uint64)
+}
+
+// Helper: Watch relDir and every directory below it, except hidden ones,
+// which scans skip. m.mu must not be held: it is only taken to record the
+// watches, so queries are answered while a large new directory is walked.
+func (m *fsmonitor) watchTree(relDir string) error {
+	root := m.repo.workPath(relDir)
+	watches := make(map[int32]string)
+	err := filepath.WalkDir(root, func(dirPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Removed while walking; its parent reported that
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if dirPath != m.repo.WorkTree && d.Name()[0] == '.' {
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(m.fd, dirPath, fsmonitorMask)
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %v", dirPath, err)
+		}
+		relPath, err := filepath.Rel(m.repo.WorkTree, dirPath)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			relPath = ""
+		}
+		watches[int32(wd)] = filepath.ToSlash(relPath)
+		return nil
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for wd, dir := range watches {
+		m.watches[wd] = dir
+	}
+	return err
+}
+
+// Helper: Read events until the inotify file is closed
+func (m *fsmonitor) readEvents() error {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := m.inotify.Read(buf)
+		if err != nil {
+			return fmt.Errorf("failed to read inotify events: %v", err)
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			name := strings.TrimRight(string(buf[offset+syscall.SizeofInotifyEvent:offset+syscall.SizeofInotifyEvent+nameLen]), "\x00")
+			offset += syscall.SizeofInotifyEvent + nameLen
+			gone, newDir := m.handle(wd, mask, name)
+			if gone {
+				m.shutdown()
+			}
+			// Files created before the watch exists are covered by the
+			// directory being reported as changed
+			if newDir != "" && m.watchTree(newDir) != nil {
+				m.mu.Lock()
+				m.unwatched = true
+				m.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Helper: Record one event; reports whether the work tree itself is gone and
+// the directory to watch if the event created one
+func (m *fsmonitor) handle(wd int32, mask uint32, name string) (bool, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		m.newInstance()
+		return false, ""
+	}
+	if wd == m.gvcWatch {
+		if cookie, ok := m.cookies[name]; ok {
+			close(cookie)
+			delete(m.cookies, name)
+		}
+		return false, ""
+	}
+	dir, ok := m.watches[wd]
+	if !ok {
+		return false, ""
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(m.watches, wd)
+		return false, ""
+	}
+	if name == "" {
+		// Events on a watched directory itself are also reported by its
+		// parent, except for the top of the work tree
+		return dir == "" && mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0, ""
+	}
+	relPath := path.Join(dir, name)
+	if relPath == GvcDirName {
+		return false, ""
+	}
+	m.seq++
+	m.changed[relPath] = m.seq
+	if len(m.changed) > fsmonitorMaxChanged {
+		m.newInstance()
+	}
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		return false, relPath
+	}
+	return false, ""
+}
+
+// Helper: Answer one request
+func (m *fsmonitor) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(fsmonitorTimeout))
+	var req fsmonitorRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	var resp fsmonitorResponse
+	switch req.Command {
+	case "query":
+		resp = m.query(req.Token)
+	case "status":
+		m.mu.Lock()
+		resp.Token = m.token()
+		m.mu.Unlock()
+	case "stop":
+		defer m.shutdown() // After answering
+	default:
+		resp.Error = fmt.Sprintf("unknown command %q", req.Command)
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func (m *fsmonitor) shutdown() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// Helper: The current token; m.mu must be held
+func (m *fsmonitor) token() string {
+	return m.instance + ":" + strconv.FormatUint(m.seq, 10)
+}
+
+// Helper: Paths changed since token. The answer is full if the token is of
+// another instance, or events could not be caught up with.
+func (m *fsmonitor) query(token string) fsmonitorResponse {
+	synced := m.sync()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastQuery = time.Now()
+	resp := fsmonitorResponse{Token: m.token()}
+	instance, seqText, _ := strings.Cut(token, ":")
+	since, err := strconv.ParseUint(seqText, 10, 64)
+	if !synced || m.unwatched || instance != m.instance || err != nil || since > m.seq {
+		resp.Full = true
+		return resp
+	}
+	for relPath, seq := range m.changed {
+		if seq > since {
+			resp.Paths = append(resp.Paths, relPath)
+		}
+	}
+	sort.Strings(resp.Paths)
+	return resp
+}
+
+// Helper: Wait until the events of changes made before the query are read,
+// by creating a cookie file in .gvc and waiting for its own event
+func (m *fsmonitor) sync() bool {
+	m.mu.Lock()
+	m.cookieSeq++
+	name := fmt.Sprintf("fsmonitor-cookie-%d", m.cookieSeq)
+	cookie := make(chan struct{})
+	m.cookies[name] = cookie
+	m.mu.Unlock()
+
+	cookiePath := m.repo.gvcPath(name)
+	defer os.Remove(cookiePath)
+	if err := os.WriteFile(cookiePath, nil, 0644); err != nil {
+		m.mu.Lock()
+		delete(m.cookies, name)
+		m.mu.Unlock()
+		return false
+	}
+	select {
+	case <-cookie:
+		return true
+	case <-time.After(fsmonitorTimeout / 2):
+		m.mu.Lock()
+		delete(m.cookies, name)
+		m.mu.Unlock()
+		return false
+	}
+}
+
+// Helper: Start "gvc fsmonitor run" for the repository in the background
+func (r *Repo) spawnFSMonitor() error {
+	exe, err := gvcExecutable()
+	if err != nil {
+		return fmt.Errorf("failed to find gvc to start fsmonitor: %v", err)
+	}
+	cmd := exec.Command(exe, "--gvc-dir", r.GvcDir, "fsmonitor", "run")
+	cmd.Dir = r.WorkTree
+	// A session of its own, so it outlives the command that started it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start fsmonitor: %v", err)
+	}
+	return cmd.Process.Release()
+}
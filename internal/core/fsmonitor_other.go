@@ -0,0 +1,14 @@
+//go:build !linux
+
+package core
+
+import "time"
+
+// RunFSMonitor needs inotify, so scans always walk the whole tree here.
+func (r *Repo) RunFSMonitor(idle time.Duration) error {
+	return ErrFSMonitorUnsupported
+}
+
+func (r *Repo) spawnFSMonitor() error {
+	return ErrFSMonitorUnsupported
+}
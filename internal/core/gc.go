@@ -0,0 +1,110 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// GCResult describes what GarbageCollect did.
+type GCResult struct {
+	Pack         string // Name of the new pack, empty if there was nothing to pack
+	Objects      int    // Objects written to the pack
+	Deltas       int    // Objects stored as deltas
+	LooseRemoved int    // Loose objects deleted because they are now packed
+	PacksRemoved int    // Old packs replaced by the new one
+	Unpacked     int    // Unreachable objects moved out of old packs as loose objects
+}
+
+// GarbageCollect repacks every object reachable from the refs, HEAD and the
+// index into a single pack, then removes the loose copies and older packs.
+// Unreachable objects are left loose so that pruning can expire them. Chunk
+// lists stay loose too: git's pack format has no type for them.
+func (r *Repo) GarbageCollect() (*GCResult, error) {
+	store, err := r.fileStore()
+	if err != nil {
+		return nil, err
+	}
+	objects, err := r.reachableObjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk reachable objects: %v", err)
+	}
+	result := &GCResult{}
+	if len(objects) == 0 {
+		return result, nil
+	}
+
+	oldPacks, err := store.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	packed := make(map[string]reachableObject, len(objects))
+	for hash, object := range objects {
+		if _, ok := packObjTypes[object.Type]; ok {
+			packed[hash] = object
+		}
+	}
+	result.Pack, result.Deltas, err = store.writePack(packed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write pack: %v", err)
+	}
+	result.Objects = len(packed)
+
+	newPack := filepath.Join(store.dir, "pack", result.Pack+".pack")
+	for _, pack := range oldPacks {
+		if pack.packPath == newPack {
+			continue // Same objects as before, packs are named by content
+		}
+		info, err := os.Stat(pack.packPath)
+		if err != nil {
+			return nil, err
+		}
+		for i, hash := range pack.names() {
+			if _, reachable := objects[hash]; reachable {
+				continue
+			}
+			if err := store.unpackObject(pack, pack.offsets[i], hash, info.ModTime()); err != nil {
+				return nil, err
+			}
+			result.Unpacked++
+		}
+		if err := store.removePack(pack); err != nil {
+			return nil, err
+		}
+		result.PacksRemoved++
+	}
+	store.reloadPacks()
+
+	loose, err := store.looseObjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range loose {
+		if _, ok := packed[hash]; !ok {
+			continue
+		}
+		if err := store.Delete(hash); err != nil {
+			return nil, err
+		}
+		result.LooseRemoved++
+	}
+	return result, nil
+}
+
+// Helper: Write a packed object out as a loose object dated modTime, the age
+// of its pack, so that unpacking does not restart prune's grace period
+func (s *FileStore) unpackObject(pack *packFile, offset uint64, hash string, modTime time.Time) error {
+	if _, err := s.readLoose(hash); err == nil {
+		return nil
+	}
+	data, err := pack.readObject(offset)
+	if err != nil {
+		return err
+	}
+	if err := s.Put(hash, data); err != nil {
+		return err
+	}
+	return os.Chtimes(s.loosePath(hash), modTime, modTime)
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ObjectFormat is the hash algorithm that names objects in a repository,
+// recorded as extensions.objectformat in .gvc/config.
+type ObjectFormat struct {
+	Name    string // "sha1" or "sha256"
+	Size    int    // Raw hash size in bytes
+	newHash func() hash.Hash
+}
+
+var (
+	SHA1   = &ObjectFormat{Name: "sha1", Size: sha1.Size, newHash: sha1.New}
+	SHA256 = &ObjectFormat{Name: "sha256", Size: sha256.Size, newHash: sha256.New}
+)
+
+// LookupObjectFormat returns the format called name; an empty name means SHA-1.
+func LookupObjectFormat(name string) (*ObjectFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "sha1":
+		return SHA1, nil
+	case "sha256":
+		return SHA256, nil
+	}
+	return nil, fmt.Errorf("unknown object format '%s'", name)
+}
+
+// HexSize is the length of a full object name.
+func (f *ObjectFormat) HexSize() int {
+	return 2 * f.Size
+}
+
+// New returns a new hash.Hash for the format.
+func (f *ObjectFormat) New() hash.Hash {
+	return f.newHash()
+}
+
+// Sum returns the raw hash of data.
+func (f *ObjectFormat) Sum(data []byte) []byte {
+	h := f.newHash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// ObjectData returns the object name and the data with its header.
+func (f *ObjectFormat) ObjectData(objType string, content []byte) (string, []byte) {
+	header := fmt.Sprintf("%s %d\x00", objType, len(content))
+	data := append([]byte(header), content...)
+	return hex.EncodeToString(f.Sum(data)), data
+}
+
+// IsValidHash reports whether hash is a full lowercase hex name in this format.
+func (f *ObjectFormat) IsValidHash(hash string) bool {
+	if len(hash) != f.HexSize() || strings.ToLower(hash) != hash {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile lists patterns of untracked files that status, add and clean
+// leave alone, with the syntax of .gitignore. It may appear in any directory
+// and its patterns are relative to that directory.
+const IgnoreFile = ".gvcignore"
+
+// Patterns are read from the global excludes file (core.excludesfile, or
+// $XDG_CONFIG_HOME/gvc/ignore), then .gvc/info/exclude, then the .gvcignore
+// files from the top of the work tree down. The last pattern matching a path
+// decides, so deeper files override shallower ones.
+
+// IgnoreMatch is the pattern deciding whether a path is ignored.
+type IgnoreMatch struct {
+	Source  string // File the pattern is in, e.g. "sub/.gvcignore" or ".gvc/info/exclude"
+	Line    int    // Line number in Source, starting at 1
+	Pattern string // The pattern as written, including a leading '!'
+	Negated bool   // The pattern re-includes the path, which is not ignored
+}
+
+// ignorePattern is one parsed line of an ignore file.
+type ignorePattern struct {
+	IgnoreMatch
+	glob     string // Pattern without '!', leading and trailing '/'
+	base     string // Directory the pattern is relative to, "" for the top
+	dirOnly  bool   // Pattern ended in '/' and only matches directories
+	anchored bool   // Pattern contained a '/' and matches from base, not any level
+}
+
+// Helper: Reports whether the pattern matches relPath
+func (p *ignorePattern) matches(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(relPath, p.base+"/") {
+			return false
+		}
+		relPath = relPath[len(p.base)+1:]
+	}
+	if !p.anchored {
+		return matchGlob(p.glob, path.Base(relPath))
+	}
+	return matchGlob(p.glob, relPath)
+}
+
+// ignoreMatcher decides which paths are ignored, reading each directory's
+// .gvcignore once.
+type ignoreMatcher struct {
+	repo     *Repo
+	global   []ignorePattern
+	dirs     map[string][]ignorePattern // Patterns of the .gvcignore in each directory
+	excluded map[string]*IgnoreMatch    // Decision for each directory checked
+}
+
+// Helper: A matcher with the global excludes and .gvc/info/exclude loaded
+func (r *Repo) newIgnoreMatcher() (*ignoreMatcher, error) {
+	m := &ignoreMatcher{repo: r, dirs: make(map[string][]ignorePattern), excluded: make(map[string]*IgnoreMatch)}
+	excludesFile := r.excludesFile()
+	sources := []struct{ file, label string }{
+		{excludesFile, excludesFile},
+		{r.gvcPath("info", "exclude"), path.Join(GvcDirName, "info", "exclude")},
+	}
+	for _, source := range sources {
+		if source.file == "" {
+			continue
+		}
+		patterns, err := readIgnoreFile(source.file, source.label, "")
+		if err != nil {
+			return nil, err
+		}
+		m.global = append(m.global, patterns...)
+	}
+	return m, nil
+}
+
+// Helper: Path of the global excludes file, "" if there is none
+func (r *Repo) excludesFile() string {
+	excludesFile, ok := r.Config.Get("core.excludesfile")
+	if !ok {
+		if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+			return filepath.Join(configHome, "gvc", "ignore")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".config", "gvc", "ignore")
+		}
+	} else if rest, found := strings.CutPrefix(excludesFile, "~/"); found {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return excludesFile
+}
+
+// Helper: The last pattern matching relPath, ignoring parent directories.
+// Nil if no pattern matches.
+func (m *ignoreMatcher) match(relPath string, isDir bool) (*IgnoreMatch, error) {
+	var patterns [][]ignorePattern
+	patterns = append(patterns, m.global)
+	dirs := []string{""}
+	for dir := parentDir(relPath); dir != ""; dir = parentDir(dir) {
+		dirs = append(dirs, dir)
+	}
+	// Top directory first, so deeper files come later and win
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dirPatterns, err := m.dirPatterns(dirs[i])
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, dirPatterns)
+	}
+	for i := len(patterns) - 1; i >= 0; i-- {
+		for j := len(patterns[i]) - 1; j >= 0; j-- {
+			if patterns[i][j].matches(relPath, isDir) {
+				return &patterns[i][j].IgnoreMatch, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Helper: The pattern that ignores relPath or one of its parent directories,
+// nil if it is not ignored. As in git, a file in an ignored directory cannot
+// be re-included.
+func (m *ignoreMatcher) ignored(relPath string, isDir bool) (*IgnoreMatch, error) {
+	if isDir {
+		if match, ok := m.excluded[relPath]; ok {
+			return match, nil
+		}
+	}
+	if dir := parentDir(relPath); dir != "" {
+		parent, err := m.ignored(dir, true)
+		if err != nil || parent != nil {
+			return parent, err
+		}
+	}
+	match, err := m.match(relPath, isDir)
+	if err != nil {
+		return nil, err
+	}
+	if match != nil && match.Negated {
+		match = nil
+	}
+	if isDir {
+		m.excluded[relPath] = match
+	}
+	return match, nil
+}
+
+// Helper: Patterns of the .gvcignore in dir, read on first use
+func (m *ignoreMatcher) dirPatterns(dir string) ([]ignorePattern, error) {
+	if patterns, ok := m.dirs[dir]; ok {
+		return patterns, nil
+	}
+	source := path.Join(dir, IgnoreFile)
+	patterns, err := readIgnoreFile(m.repo.workPath(source), source, dir)
+	if err != nil {
+		return nil, err
+	}
+	m.dirs[dir] = patterns
+	return patterns, nil
+}
+
+// Helper: Parse an ignore file; a missing file has no patterns
+func readIgnoreFile(file, label, base string) ([]ignorePattern, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", label, err)
+	}
+	var patterns []ignorePattern
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		// Trailing spaces are dropped unless escaped with a backslash
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p := ignorePattern{IgnoreMatch: IgnoreMatch{Source: label, Line: i + 1, Pattern: line}, base: base}
+		glob := line
+		if glob[0] == '!' {
+			p.Negated = true
+			glob = glob[1:]
+		} else if strings.HasPrefix(glob, "\\!") || strings.HasPrefix(glob, "\\#") {
+			glob = glob[1:]
+		}
+		if strings.HasSuffix(glob, "/") {
+			p.dirOnly = true
+			glob = strings.TrimSuffix(glob, "/")
+		}
+		p.anchored = strings.Contains(glob, "/")
+		p.glob = strings.TrimPrefix(glob, "/")
+		if p.glob == "" {
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// Helper: Match a slash-separated name against a glob where "**" as a whole
+// segment matches any number of directories
+func matchGlob(glob, name string) bool {
+	return matchSegments(strings.Split(glob, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(glob, name []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			// A trailing "**" matches everything inside, but not the directory itself
+			if len(glob) == 1 {
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(glob[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], name[0]); !ok {
+			return false
+		}
+		glob, name = glob[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// CheckIgnore returns the pattern that decides whether path is ignored, or
+// nil if no pattern matches. Tracked files are never ignored. path may be
+// absolute or relative to the current directory.
+func (r *Repo) CheckIgnore(filePath string) (*IgnoreMatch, error) {
+	relPath, err := r.RelPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+	index, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	if _, tracked := index.GetEntry(relPath); tracked || relPath == "." {
+		return nil, nil
+	}
+	m, err := r.newIgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+	if dir := parentDir(relPath); dir != "" {
+		if match, err := m.ignored(dir, true); err != nil || match != nil {
+			return match, err
+		}
+	}
+	info, err := os.Lstat(r.workPath(relPath))
+	isDir := err == nil && info.IsDir()
+	return m.match(relPath, isDir)
+}
@@ -1,88 +1,188 @@
 package core
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 )
 
 // IndexEntry represents a file in the staging area.
 type IndexEntry struct {
-	Path     string `json:"path"`     // File path relative to repo root
-	BlobHash string `json:"blobHash"` // SHA-1 hash of the blob
-	Type     string `json:"type"`     // Type of file (executable or regular)
+	Path     string   `json:"path"`              // File path relative to repo root
+	BlobHash string   `json:"blobHash"`          // Hash of the blob (or chunks object)
+	Type     string   `json:"type"`              // Type of file (executable or regular)
+	ObjType  string   `json:"objType,omitempty"` // "chunks" for chunked files, empty for blobs
+	Stat     FileStat `json:"stat"`              // Stat data when BlobHash was computed, zero if unknown
+}
+
+// ObjectType returns the type of the object BlobHash names.
+func (e IndexEntry) ObjectType() string {
+	if e.ObjType == "" {
+		return "blob"
+	}
+	return e.ObjType
 }
 
 // Index is the staging area (list of entries).
 type Index []IndexEntry
 
-// internal/core/index.go
-
-const indexPath = ".gvc/index.json"
+const (
+	indexFile       = "index"
+	legacyIndexFile = "index.json" // JSON index written by older versions
+)
 
-// LoadIndex reads the staging area from .gvc/index.json.
-func LoadIndex() (*Index, error) {
-	data, err := os.ReadFile(indexPath)
+// LoadIndex reads the staging area from .gvc/index. A JSON index from an
+// older version is converted to the binary format on first use.
+func (r *Repo) LoadIndex() (*Index, error) {
+	data, err := os.ReadFile(r.gvcPath(indexFile))
 	if os.IsNotExist(err) {
-		return &Index{}, nil // Return empty index if file doesn't exist
+		return r.upgradeLegacyIndex()
 	} else if err != nil {
 		return nil, err
 	}
+	index, err := decodeIndex(data, r.Format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", r.gvcPath(indexFile), err)
+	}
+	return index, nil
+}
 
-	if len(data) == 0 {
-		return &Index{}, nil // Return empty index if data is empty
+// SaveIndex writes the staging area to .gvc/index. Stat data of files
+// modified within racyWindow of the write is dropped, so that a change made
+// in the same timestamp tick is not hidden once the index is rewritten later.
+func (r *Repo) SaveIndex(idx *Index) error {
+	lock, err := r.lockIndex()
+	if err != nil {
+		return err
+	}
+	return r.writeIndex(lock, idx)
+}
+
+// Helper: Lock .gvc/index. Commands that load, change and save the index
+// take the lock before loading, so concurrent updates are not lost.
+func (r *Repo) lockIndex() (*lockFile, error) {
+	return acquireLock(r.gvcPath(indexFile))
+}
+
+// Helper: Write idx through the held index lock and release it
+func (r *Repo) writeIndex(lock *lockFile, idx *Index) error {
+	defer lock.rollback()
+	racy := time.Now().Add(-racyWindow).UnixNano()
+	for i := range *idx {
+		if (*idx)[i].Stat.MTime >= racy {
+			(*idx)[i].Stat = FileStat{}
+		}
+	}
+	data, err := encodeIndex(idx, r.Format)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write(data); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	if err := lock.commit(0644); err != nil {
+		return err
 	}
+	os.Remove(r.gvcPath(legacyIndexFile)) // Replaced if it was loaded while locked
+	return nil
+}
 
-	var index Index
-	if err := json.Unmarshal(data, &index); err != nil {
+// Helper: Read .gvc/index.json and replace it with a binary index
+func (r *Repo) upgradeLegacyIndex() (*Index, error) {
+	data, err := os.ReadFile(r.gvcPath(legacyIndexFile))
+	if os.IsNotExist(err) {
+		return &Index{}, nil // Return empty index if file doesn't exist
+	} else if err != nil {
 		return nil, err
 	}
-	return &index, nil
+
+	index := &Index{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, index); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", r.gvcPath(legacyIndexFile), ErrCorruptIndex, err)
+		}
+	}
+	// On failure, e.g. in a read-only repository, keep using the JSON index
+	r.SaveIndex(index)
+	return index, nil
 }
 
-// SaveIndex writes the staging area to .gvc/index.json.
-func (idx *Index) SaveIndex() error {
-	data, err := json.MarshalIndent(idx, "", "  ")
+// Helper: Modification time of the index file, zero if there is none
+func (r *Repo) indexModTime() time.Time {
+	info, err := os.Stat(r.gvcPath(indexFile))
 	if err != nil {
-		return err
+		return time.Time{}
 	}
-	return os.WriteFile(indexPath, data, 0644)
+	return info.ModTime()
 }
 
 // GetEntry returns the index entry for a given path.
 func (idx *Index) GetEntry(path string) (*IndexEntry, bool) {
-	for _, entry := range *idx {
-		if entry.Path == path {
-			return &entry, true
+	for i := range *idx {
+		if (*idx)[i].Path == path {
+			return &(*idx)[i], true
 		}
 	}
 	return nil, false
 }
 
+// FileChange describes a path that differs between HEAD and the index.
+type FileChange struct {
+	Path      string
+	Change    ChangeType
+	HeadMode  string // Empty if the path is not in HEAD
+	HeadHash  string
+	IndexMode string // Empty if the path is not in the index
+	IndexHash string
+}
+
 // Returns a list of files that are different between the index and the HEAD commit.
-func (index *Index) CompareToHead() ([]string, error) {
-    headTreeHash, err := GetHeadTree()
-    if err != nil {
-        return nil, fmt.Errorf("failed to get head tree: %v", err)
-    }
-
-    treeFiles, err := GetTreeFiles(headTreeHash)
-    if err != nil {
-        return nil, fmt.Errorf("failed to get tree files: %v", err)
-    }
-
-    var stagedChanges []string
-
-    for _, entry := range *index {
-        headBlob, exists := treeFiles[entry.Path]
-        if !exists {
-            // File in index is not in HEAD → file added
-            stagedChanges = append(stagedChanges, fmt.Sprintf("added: %s", entry.Path))
-        } else if headBlob != entry.BlobHash {
-            // File exists but blob hash is different → file modified
-            stagedChanges = append(stagedChanges, fmt.Sprintf("modified: %s", entry.Path))
-        }
-    }
-
-    return stagedChanges, nil
+func (index *Index) CompareToHead(r *Repo) ([]FileChange, error) {
+	headTreeHash, err := r.GetHeadTree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get head tree: %v", err)
+	}
+
+	treeFiles := map[string]TreeEntry{}
+	if headTreeHash != "" {
+		treeFiles, err = r.GetTreeEntries(headTreeHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tree files: %v", err)
+		}
+	}
+
+	var stagedChanges []FileChange
+	inIndex := make(map[string]bool, len(*index))
+
+	for _, entry := range *index {
+		inIndex[entry.Path] = true
+		headEntry, exists := treeFiles[entry.Path]
+		change := FileChange{Path: entry.Path, IndexMode: entry.Type, IndexHash: entry.BlobHash}
+		if !exists {
+			// File in index is not in HEAD → file added
+			change.Change = Added
+			stagedChanges = append(stagedChanges, change)
+		} else if headEntry.Hash != entry.BlobHash || headEntry.Mode != entry.Type {
+			// File exists but blob hash or mode is different → file modified
+			change.Change = Modified
+			change.HeadMode, change.HeadHash = headEntry.Mode, headEntry.Hash
+			stagedChanges = append(stagedChanges, change)
+		}
+	}
+
+	for path, headEntry := range treeFiles {
+		if !inIndex[path] {
+			// File in HEAD is no longer in the index → file deleted
+			stagedChanges = append(stagedChanges, FileChange{
+				Path:     path,
+				Change:   Deleted,
+				HeadMode: headEntry.Mode,
+				HeadHash: headEntry.Hash,
+			})
+		}
+	}
+
+	return stagedChanges, nil
 }
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// The index file .gvc/index is binary:
+//
+//	header     "GVCI", version (uint32), entry count (uint32)
+//	entries    sorted by path, see encodeIndexEntry
+//	extensions signature (4 bytes), length (uint32), data; repeated
+//	checksum   hash of everything above in the repository's object format
+//
+// All integers are big-endian. As in git, an extension whose signature
+// starts with an uppercase letter is optional and skipped by readers that do
+// not know it; any other unknown extension makes the index unreadable.
+
+const indexVersion = 1
+
+var indexSignature = []byte("GVCI")
+
+// ErrCorruptIndex is returned when the index file fails validation.
+var ErrCorruptIndex = errors.New("index file corrupt")
+
+// Flags stored with each entry
+const indexFlagChunks = 1 << 0 // BlobHash names a chunks object
+
+// Helper: Serialize the index in the binary format
+func encodeIndex(idx *Index, format *ObjectFormat) ([]byte, error) {
+	entries := append(Index(nil), *idx...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	var buf bytes.Buffer
+	buf.Write(indexSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(indexVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(len(entries)))
+	for _, entry := range entries {
+		if err := encodeIndexEntry(&buf, entry, format); err != nil {
+			return nil, err
+		}
+	}
+	buf.Write(format.Sum(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+// Helper: Entry layout: ctime, mtime (int64 ns), inode (uint64), stat mode
+// (uint32), size (int64), file mode (uint32), object hash (raw), flags
+// (uint16), path length (uint16), path
+func encodeIndexEntry(buf *bytes.Buffer, entry IndexEntry, format *ObjectFormat) error {
+	mode, err := strconv.ParseUint(entry.Type, 8, 32)
+	if err != nil {
+		return fmt.Errorf("index entry %s has invalid mode '%s'", entry.Path, entry.Type)
+	}
+	hash, err := decodeHexHash(entry.BlobHash, format)
+	if err != nil {
+		return fmt.Errorf("index entry %s: %v", entry.Path, err)
+	}
+	if len(entry.Path) > 0xffff {
+		return fmt.Errorf("index entry %s: path too long", entry.Path)
+	}
+	var flags uint16
+	switch entry.ObjType {
+	case "":
+	case "chunks":
+		flags |= indexFlagChunks
+	default:
+		return fmt.Errorf("index entry %s has invalid object type '%s'", entry.Path, entry.ObjType)
+	}
+
+	binary.Write(buf, binary.BigEndian, entry.Stat.CTime)
+	binary.Write(buf, binary.BigEndian, entry.Stat.MTime)
+	binary.Write(buf, binary.BigEndian, entry.Stat.Inode)
+	binary.Write(buf, binary.BigEndian, entry.Stat.Mode)
+	binary.Write(buf, binary.BigEndian, entry.Stat.Size)
+	binary.Write(buf, binary.BigEndian, uint32(mode))
+	buf.Write(hash)
+	binary.Write(buf, binary.BigEndian, flags)
+	binary.Write(buf, binary.BigEndian, uint16(len(entry.Path)))
+	buf.WriteString(entry.Path)
+	return nil
+}
+
+// Helper: Parse and validate a binary index
+func decodeIndex(data []byte, format *ObjectFormat) (*Index, error) {
+	if len(data) < len(indexSignature)+8+format.Size {
+		return nil, fmt.Errorf("%w: file is truncated", ErrCorruptIndex)
+	}
+	if !bytes.Equal(data[:4], indexSignature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrCorruptIndex)
+	}
+	body, checksum := data[:len(data)-format.Size], data[len(data)-format.Size:]
+	if !bytes.Equal(format.Sum(body), checksum) {
+		return nil, fmt.Errorf("%w: checksum mismatch (truncated or modified file)", ErrCorruptIndex)
+	}
+	version := binary.BigEndian.Uint32(body[4:])
+	if version != indexVersion {
+		return nil, fmt.Errorf("unsupported index version %d (this gvc supports %d)", version, indexVersion)
+	}
+	count := binary.BigEndian.Uint32(body[8:])
+
+	r := bytes.NewReader(body[12:])
+	index := make(Index, 0, count)
+	for i := uint32(0); i < count; i++ {
+		entry, err := decodeIndexEntry(r, format)
+		if err != nil {
+			return nil, fmt.Errorf("%w: entry %d: %v", ErrCorruptIndex, i, err)
+		}
+		if n := len(index); n > 0 && index[n-1].Path >= entry.Path {
+			return nil, fmt.Errorf("%w: entries out of order at %s", ErrCorruptIndex, entry.Path)
+		}
+		index = append(index, entry)
+	}
+
+	for r.Len() > 0 {
+		var header struct {
+			Signature [4]byte
+			Length    uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil || int64(header.Length) > int64(r.Len()) {
+			return nil, fmt.Errorf("%w: truncated extension", ErrCorruptIndex)
+		}
+		if header.Signature[0] < 'A' || header.Signature[0] > 'Z' {
+			return nil, fmt.Errorf("index uses required extension '%s' that this gvc does not support", header.Signature[:])
+		}
+		r.Seek(int64(header.Length), io.SeekCurrent) // Optional extensions can be ignored
+	}
+	return &index, nil
+}
+
+// Helper: Read one entry written by encodeIndexEntry
+func decodeIndexEntry(r *bytes.Reader, format *ObjectFormat) (IndexEntry, error) {
+	var fixed struct {
+		CTime    int64
+		MTime    int64
+		Inode    uint64
+		StatMode uint32
+		Size     int64
+		Mode     uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &fixed); err != nil {
+		return IndexEntry{}, errors.New("truncated entry")
+	}
+	hash := make([]byte, format.Size)
+	var tail struct {
+		Flags   uint16
+		PathLen uint16
+	}
+	if _, err := io.ReadFull(r, hash); err != nil {
+		return IndexEntry{}, errors.New("truncated entry")
+	}
+	if err := binary.Read(r, binary.BigEndian, &tail); err != nil {
+		return IndexEntry{}, errors.New("truncated entry")
+	}
+	path := make([]byte, tail.PathLen)
+	if _, err := io.ReadFull(r, path); err != nil || len(path) == 0 {
+		return IndexEntry{}, errors.New("truncated entry")
+	}
+	entry := IndexEntry{
+		Path:     string(path),
+		BlobHash: hex.EncodeToString(hash),
+		Type:     fmt.Sprintf("%06o", fixed.Mode),
+		Stat: FileStat{
+			Size:  fixed.Size,
+			MTime: fixed.MTime,
+			CTime: fixed.CTime,
+			Inode: fixed.Inode,
+			Mode:  fixed.StatMode,
+		},
+	}
+	if tail.Flags&indexFlagChunks != 0 {
+		entry.ObjType = "chunks"
+	}
+	return entry, nil
+}
+
+// Helper: Raw bytes of a full hex object name
+func decodeHexHash(hash string, format *ObjectFormat) ([]byte, error) {
+	if err := checkHash(format, hash); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(hash)
+}
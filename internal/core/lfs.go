@@ -0,0 +1,267 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Large files are stored the way git-lfs does it: paths matching a pattern in
+// .gvcattributes with filter=lfs are copied into .gvc/lfs/objects, named by
+// the SHA-256 of their content, and the tree only records a small pointer
+// blob. Checkout replaces pointers with the real content again.
+
+const (
+	lfsSpecURL        = "https://git-lfs.github.com/spec/v1"
+	lfsAttributes     = "filter=lfs diff=lfs merge=lfs -text"
+	lfsMaxPointerSize = 1024 // Larger blobs are never parsed as pointers
+)
+
+// LFSPointer identifies a large object by the SHA-256 of its content.
+type LFSPointer struct {
+	OID  string
+	Size int64
+}
+
+// Bytes returns the pointer file committed in place of the content.
+func (p LFSPointer) Bytes() []byte {
+	return []byte(fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", lfsSpecURL, p.OID, p.Size))
+}
+
+// ParseLFSPointer reports whether data is a pointer file and decodes it.
+func ParseLFSPointer(data []byte) (LFSPointer, bool) {
+	var pointer LFSPointer
+	if len(data) > lfsMaxPointerSize || !bytes.HasPrefix(data, []byte("version "+lfsSpecURL+"\n")) {
+		return pointer, false
+	}
+	hasSize := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")[1:] {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			oid, found := strings.CutPrefix(value, "sha256:")
+			if !found || !SHA256.IsValidHash(oid) {
+				return pointer, false
+			}
+			pointer.OID = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return pointer, false
+			}
+			pointer.Size, hasSize = size, true
+		}
+	}
+	return pointer, pointer.OID != "" && hasSize
+}
+
+// LFSFile is a staged file whose blob is an LFS pointer.
+type LFSFile struct {
+	Path    string
+	Pointer LFSPointer
+	Present bool // The content is in the local LFS store
+}
+
+// LFSPatterns returns the patterns in .gvcattributes that use the lfs filter.
+func (r *Repo) LFSPatterns() ([]string, error) {
+	attrs, err := r.loadAttributes()
+	if err != nil {
+		return nil, err
+	}
+	return attrs.lfs, nil
+}
+
+// LFSTrack adds patterns to .gvcattributes and returns the ones that were not
+// tracked yet.
+func (r *Repo) LFSTrack(patterns []string) ([]string, error) {
+	existing, err := r.LFSPatterns()
+	if err != nil {
+		return nil, err
+	}
+	tracked := make(map[string]bool, len(existing))
+	for _, pattern := range existing {
+		tracked[pattern] = true
+	}
+
+	var added []string
+	var lines bytes.Buffer
+	for _, pattern := range patterns {
+		if tracked[pattern] {
+			continue
+		}
+		if strings.ContainsAny(pattern, " \t") {
+			return nil, fmt.Errorf("pattern '%s' must not contain whitespace", pattern)
+		}
+		tracked[pattern] = true
+		added = append(added, pattern)
+		fmt.Fprintf(&lines, "%s %s\n", pattern, lfsAttributes)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(r.workPath(AttributesFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	if err := os.WriteFile(r.workPath(AttributesFile), append(data, lines.Bytes()...), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", AttributesFile, err)
+	}
+	return added, nil
+}
+
+// LFSFiles returns the staged files stored as LFS pointers.
+func (r *Repo) LFSFiles() ([]LFSFile, error) {
+	index, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	var files []LFSFile
+	for _, entry := range *index {
+		pointer, ok, err := r.readLFSPointer(entry.BlobHash)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		_, err = os.Stat(r.lfsObjectPath(pointer.OID))
+		files = append(files, LFSFile{Path: entry.Path, Pointer: pointer, Present: err == nil})
+	}
+	return files, nil
+}
+
+// LFSPrune deletes large objects that no pointer in the history or the index
+// refers to. With dryRun set nothing is deleted.
+func (r *Repo) LFSPrune(dryRun bool) ([]LFSPointer, error) {
+	reachable, err := r.reachableObjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk reachable objects: %v", err)
+	}
+	inUse := make(map[string]bool)
+	for hash, object := range reachable {
+		if object.Type != "blob" {
+			continue
+		}
+		pointer, ok, err := r.readLFSPointer(hash)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			inUse[pointer.OID] = true
+		}
+	}
+
+	var pruned []LFSPointer
+	root := r.gvcPath("lfs", "objects")
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !SHA256.IsValidHash(d.Name()) || inUse[d.Name()] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			// Only succeed once the fan-out directories are empty
+			os.Remove(filepath.Dir(path))
+			os.Remove(filepath.Dir(filepath.Dir(path)))
+		}
+		pruned = append(pruned, LFSPointer{OID: d.Name(), Size: info.Size()})
+		return nil
+	})
+	return pruned, err
+}
+
+// Helper: Copy src into the LFS store and return its pointer
+func (r *Repo) storeLFSObject(src io.Reader) (LFSPointer, error) {
+	if err := os.MkdirAll(r.gvcPath("lfs", "objects"), 0755); err != nil {
+		return LFSPointer{}, err
+	}
+	tmp, err := os.CreateTemp(r.gvcPath("lfs"), ".tmp-")
+	if err != nil {
+		return LFSPointer{}, err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if err != nil {
+		return LFSPointer{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return LFSPointer{}, err
+	}
+	pointer := LFSPointer{OID: hex.EncodeToString(h.Sum(nil)), Size: size}
+
+	objectPath := r.lfsObjectPath(pointer.OID)
+	if _, err := os.Stat(objectPath); err == nil {
+		return pointer, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return LFSPointer{}, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return LFSPointer{}, err
+	}
+	return pointer, os.Rename(tmp.Name(), objectPath)
+}
+
+// Helper: The pointer a work tree file would be stored as, without storing it
+func lfsPointerForFile(filePath string) (LFSPointer, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return LFSPointer{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return LFSPointer{}, err
+	}
+	return LFSPointer{OID: hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+}
+
+// Helper: Decode a blob as an LFS pointer without reading large blobs
+func (r *Repo) readLFSPointer(hash string) (LFSPointer, bool, error) {
+	blob, size, err := r.OpenBlob(hash)
+	if err != nil {
+		return LFSPointer{}, false, err
+	}
+	defer blob.Close()
+	if size > lfsMaxPointerSize {
+		return LFSPointer{}, false, nil
+	}
+	data, err := io.ReadAll(bufio.NewReader(blob))
+	if err != nil {
+		return LFSPointer{}, false, err
+	}
+	pointer, ok := ParseLFSPointer(data)
+	return pointer, ok, nil
+}
+
+// Helper: Path of a large object, sharded like git-lfs as ab/cd/abcd...
+func (r *Repo) lfsObjectPath(oid string) string {
+	return r.gvcPath("lfs", "objects", oid[:2], oid[2:4], oid)
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Files under .gvc are updated the way git does it: the new content is
+// written to "<file>.lock", created with O_EXCL so only one process can hold
+// it, then synced and renamed over the file. Readers see either the old or the
+// new content, and a second writer fails instead of overwriting the first.
+
+const lockSuffix = ".lock"
+
+// A lock file younger than this is never treated as stale, so a lock just
+// created by another process is left alone before that process holds it.
+const staleLockGrace = time.Second
+
+// ErrLocked is returned when another process holds the lock on a file.
+var ErrLocked = errors.New("another gvc process seems to be running in this repository")
+
+// lockFile is a held lock on path; the content written to it replaces path
+// on commit.
+type lockFile struct {
+	path string
+	f    *os.File // nil once committed or rolled back
+}
+
+// Helper: Create path.lock, removing it first if its holder is gone
+func acquireLock(path string) (*lockFile, error) {
+	lockPath := path + lockSuffix
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) && removeStaleLock(lockPath) {
+		f, err = os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%w: unable to create '%s' (if no other gvc process is running, remove the file)", ErrLocked, lockPath)
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to create '%s': %v", lockPath, err)
+	}
+	if err := holdLock(f); err != nil {
+		releaseLock(f)
+		return nil, fmt.Errorf("unable to lock '%s': %v", lockPath, err)
+	}
+	return &lockFile{path: path, f: f}, nil
+}
+
+func (l *lockFile) Write(p []byte) (int, error) {
+	return l.f.Write(p)
+}
+
+// commit syncs the written content to disk and renames it over the locked file.
+func (l *lockFile) commit(perm os.FileMode) error {
+	f := l.f
+	l.f = nil
+	err := f.Chmod(perm)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = renameLock(f, l.path)
+	}
+	if err != nil {
+		releaseLock(f)
+		return fmt.Errorf("failed to write %s: %v", l.path, err)
+	}
+	// Make the rename itself durable
+	return syncDir(l.path)
+}
+
+// rollback releases the lock without touching the locked file. It does
+// nothing after commit, so it can be deferred.
+func (l *lockFile) rollback() {
+	if l.f == nil {
+		return
+	}
+	releaseLock(l.f)
+	l.f = nil
+}
+
+// Helper: Replace path with data while holding its lock
+func writeLocked(path string, data []byte, perm os.FileMode) error {
+	lock, err := acquireLock(path)
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+	if _, err := lock.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return lock.commit(perm)
+}
+
+// Helper: Point the ref at refPath (relative to .gvc) to newHash, failing if
+// another process moved it away from oldHash in the meantime
+func (r *Repo) updateRef(refPath, newHash, oldHash string) error {
+	lock, err := acquireLock(r.gvcPath(refPath))
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+	current, err := os.ReadFile(r.gvcPath(refPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if found := strings.TrimSpace(string(current)); found != oldHash {
+		return fmt.Errorf("%s was updated to %s by another process, expected %s", refPath, found, oldHash)
+	}
+	if _, err := lock.Write([]byte(newHash)); err != nil {
+		return fmt.Errorf("failed to write %s: %v", refPath, err)
+	}
+	return lock.commit(0644)
+}
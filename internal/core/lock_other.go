@@ -0,0 +1,37 @@
+//go:build !linux && !darwin
+
+package core
+
+import "os"
+
+// Helper: Lock files are only held by their existence on this platform
+func holdLock(f *os.File) error {
+	return nil
+}
+
+// Helper: Without flock a crashed holder cannot be told apart from a running
+// one, so lock files are left for the user to remove. Reports whether the
+// lock file is gone.
+func removeStaleLock(lockPath string) bool {
+	_, err := os.Stat(lockPath)
+	return os.IsNotExist(err)
+}
+
+// Helper: Rename the lock file over path; open files cannot be renamed here
+func renameLock(f *os.File, path string) error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Helper: Remove the lock file; open files cannot be removed here
+func releaseLock(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// Helper: Directories cannot be synced on this platform
+func syncDir(path string) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build linux || darwin
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Helper: Take an flock on a new lock file. The kernel drops it when the
+// process exits, which is how other processes tell a stale lock file apart.
+func holdLock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// Helper: Remove lockPath if no process holds it. Reports whether the lock
+// file is gone.
+func removeStaleLock(lockPath string) bool {
+	f, err := os.Open(lockPath)
+	if err != nil {
+		return os.IsNotExist(err) // Released in the meantime
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || time.Since(info.ModTime()) < staleLockGrace {
+		return false
+	}
+	if syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) != nil {
+		return false // The holder is still running
+	}
+	// Only remove the file we checked, not a lock another process just took
+	current, err := os.Stat(lockPath)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	if !os.SameFile(info, current) {
+		return false
+	}
+	return os.Remove(lockPath) == nil
+}
+
+// Helper: Rename the lock file over path, releasing the flock only afterwards
+// so the lock never looks stale while it is still in place. On failure f is
+// left open for releaseLock.
+func renameLock(f *os.File, path string) error {
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Helper: Remove the lock file, releasing the flock only afterwards, so that
+// no other process finds it unlocked, takes it over as stale and then loses
+// it to this removal
+func releaseLock(f *os.File) {
+	os.Remove(f.Name())
+	f.Close()
+}
+
+// Helper: Sync the directory containing path, persisting renames in it
+func syncDir(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -1,27 +1,77 @@
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
-func LogCommits() ([]*Commit, error) {
-
-	var commits []*Commit
-	hash, err := getCurrentCommit()
+func (r *Repo) LogCommits() ([]*Commit, error) {
+	hash, err := r.getCurrentCommit()
 	if err != nil {
 		return nil, fmt.Errorf("getting current commit: %v", err)
 	}
+	return r.logFrom(hash, nil)
+}
+
+// LogFrom returns the history of the commit rev resolves to, newest first.
+// rev is anything ResolveCommit accepts, such as a branch or a tag.
+func (r *Repo) LogFrom(rev string) ([]*Commit, error) {
+	hash, err := r.ResolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	return r.logFrom(hash, nil)
+}
+
+// LogRange returns the commits reachable from rng.To but not from rng.From,
+// or for a symmetric range those reachable from either but not both, newest
+// first.
+func (r *Repo) LogRange(rng RevisionRange) ([]*Commit, error) {
+	from, err := r.ResolveCommit(rng.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.ResolveCommit(rng.To)
+	if err != nil {
+		return nil, err
+	}
+	fromAncestors, err := r.ancestors(from)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := r.logFrom(to, fromAncestors)
+	if err != nil || !rng.Symmetric {
+		return commits, err
+	}
+	toAncestors, err := r.ancestors(to)
+	if err != nil {
+		return nil, err
+	}
+	others, err := r.logFrom(from, toAncestors)
+	if err != nil {
+		return nil, err
+	}
+	commits = append(commits, others...)
+	sort.SliceStable(commits, func(i, j int) bool { return commits[i].Date.After(commits[j].Date) })
+	return commits, nil
+}
 
-	for hash != "" {
-        commit, err := GetCommit(hash)
-        if err != nil {
-            return nil, err
-        }
-        commits = append(commits, commit)
-        hash = commit.Parent
-    }
+// Helper: The commits from hash back to the first one, stopping at any
+// commit in exclude
+func (r *Repo) logFrom(hash string, exclude map[string]bool) ([]*Commit, error) {
+	var commits []*Commit
+	for hash != "" && !exclude[hash] {
+		commit, err := r.GetCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, commit)
+		hash = commit.Parent
+	}
 
 	// commit, err := GetCommit("a9fb5a712cc3853a8b60ed509f0e23f02a4dee26")
 
 	// fmt.Printf("%+v\n", *commit)
 
-	return commits, err
+	return commits, nil
 }
@@ -2,50 +2,209 @@ package core
 
 import (
 	"bytes"
-	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
 
-// CreateObject creates a Git-like object (blob/tree/commit).
-func CreateObject(objType string, content []byte) (string, error) {
-	hashStr, data := GetObjectData(objType, content)
+// CreateObject creates a Git-like object (blob/tree/commit/tag).
+func (r *Repo) CreateObject(objType string, content []byte) (string, error) {
+	hashStr, data := r.GetObjectData(objType, content)
+	if store, err := r.fileStore(); err == nil && store.freshen(hashStr) {
+		return hashStr, nil // Objects are immutable, only restart prune's grace period
+	}
+	if r.HasObject(hashStr) {
+		return hashStr, nil // Objects are immutable, nothing to do
+	}
+	return hashStr, r.Objects.Put(hashStr, data)
+}
 
-	// Save to .gvc/objects/ab/cdef1234...
-	objectPath := filepath.Join(".gvc", "objects", hashStr[:2], hashStr[2:])
-	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+// CreateObjectFromReader stores size bytes read from src as an object of
+// objType. Stores that support streaming never hold the content in memory.
+func (r *Repo) CreateObjectFromReader(objType string, size int64, src io.Reader) (string, error) {
+	if store := r.streamStore(); store != nil {
+		return store.PutStream(objType, size, src)
+	}
+	content, err := io.ReadAll(io.LimitReader(src, size+1))
+	if err != nil {
 		return "", err
 	}
+	if int64(len(content)) != size {
+		return "", fmt.Errorf("expected %d bytes of content, got %d (was the file modified while reading?)", size, len(content))
+	}
+	return r.CreateObject(objType, content)
+}
 
-	return hashStr, os.WriteFile(objectPath, data, 0644)
+// GetObjectData returns the object hash and data with the header, hashed
+// with the repository's object format.
+func (r *Repo) GetObjectData(objType string, content []byte) (string, []byte) {
+	return r.Format.ObjectData(objType, content)
 }
 
-// GetObjectData returns the object hash and data with the header.
-func GetObjectData(objType string, content []byte) (string, []byte) {
-	header := fmt.Sprintf("%s %d\x00", objType, len(content))
-	data := append([]byte(header), content...)
+// GetObjectContent returns the content of a Git object, including its header.
+func (r *Repo) GetObjectContent(hash string) ([]byte, error) {
+	return r.Objects.Get(hash)
+}
 
-	hash := sha1.Sum(data)
-	return hex.EncodeToString(hash[:]), data
+// OpenObject streams the content of an object and returns its type and size.
+// The caller must close the reader.
+func (r *Repo) OpenObject(hash string) (string, int64, io.ReadCloser, error) {
+	if store := r.streamStore(); store != nil {
+		return store.Open(hash)
+	}
+	data, err := r.GetObjectContent(hash)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	typ, content, err := splitObject(data)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("%s: %v", hash, err)
+	}
+	return typ, int64(len(content)), io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// OpenBlob streams the content of a file object and returns its size. Files
+// stored as chunks are reassembled.
+func (r *Repo) OpenBlob(hash string) (io.ReadCloser, int64, error) {
+	typ, size, content, err := r.OpenObject(hash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open object: %v", err)
+	}
+	switch typ {
+	case "blob":
+		return content, size, nil
+	case "chunks":
+		data, err := io.ReadAll(content)
+		content.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+		chunks, err := parseChunkList(hash, data)
+		if err != nil {
+			return nil, 0, err
+		}
+		var total int64
+		for _, chunk := range chunks {
+			total += chunk.Size
+		}
+		return &chunkReader{repo: r, chunks: chunks}, total, nil
+	}
+	content.Close()
+	return nil, 0, fmt.Errorf("invalid blob object: %s", hash)
+}
+
+// HashFile returns the blob hash of a file's content without storing it,
+// reading the file in chunks.
+func (r *Repo) HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	h := r.Format.New()
+	fmt.Fprintf(h, "blob %d\x00", info.Size())
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	if n != info.Size() {
+		return "", fmt.Errorf("%s changed while reading", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-// GetObjectContent returns the content of a Git object.
-func GetObjectContent(hash string) ([]byte, error) {
-	objectPath := filepath.Join(".gvc", "objects", hash[:2], hash[2:])
-	return os.ReadFile(objectPath)
+// HasObject reports whether hash is in the object store.
+func (r *Repo) HasObject(hash string) bool {
+	ok, err := r.Objects.Has(hash)
+	return err == nil && ok
 }
 
-func ReadBlobData(hash string) ([]byte, error) {
-	content, err := GetObjectContent(hash)
+// ReadBlobData returns the content of a file object, reassembling chunks.
+func (r *Repo) ReadBlobData(hash string) ([]byte, error) {
+	content, _, err := r.OpenBlob(hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get object content: %v", err)
 	}
-	// Split header and content
-	parts := bytes.SplitN(content, []byte{0}, 2)
-	if len(parts) != 2 || !bytes.HasPrefix(parts[0], []byte("blob")) {
-		return nil, fmt.Errorf("invalid blob object: %s", hash)
+	defer content.Close()
+	return io.ReadAll(content)
+}
+
+// MigrateObjects compresses every uncompressed loose object and upgrades the
+// repository to the current format version. It returns the number of objects
+// rewritten.
+func (r *Repo) MigrateObjects() (int, error) {
+	store, err := r.fileStore()
+	if err != nil {
+		return 0, err
+	}
+	migrated, err := store.migrate()
+	if err != nil {
+		return migrated, err
+	}
+
+	r.Config.Set("core.repositoryformatversion", fmt.Sprint(currentFormatVersion))
+	if err := r.SaveConfig(); err != nil {
+		return migrated, fmt.Errorf("failed to save config: %v", err)
+	}
+	return migrated, nil
+}
+
+// Helper: The filesystem store behind r.Objects, for operations such as gc
+// and prune that work on the on-disk layout
+func (r *Repo) fileStore() (*FileStore, error) {
+	store := r.Objects
+	for {
+		switch s := store.(type) {
+		case *FileStore:
+			return s, nil
+		case interface{ Unwrap() ObjectStore }:
+			store = s.Unwrap()
+		default:
+			return nil, fmt.Errorf("operation requires the filesystem object store")
+		}
+	}
+}
+
+// Helper: The first store in the r.Objects wrapper chain that can stream, or nil
+func (r *Repo) streamStore() StreamStore {
+	store := r.Objects
+	for {
+		if s, ok := store.(StreamStore); ok {
+			return s
+		}
+		u, ok := store.(interface{ Unwrap() ObjectStore })
+		if !ok {
+			return nil
+		}
+		store = u.Unwrap()
+	}
+}
+
+// Helper: Write a file through a temporary file and rename, so readers never
+// observe a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return err
 	}
-	return parts[1], nil
+	return os.Rename(tmp.Name(), path)
 }
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ErrObjectNotFound is returned by ObjectStore.Get for unknown hashes.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is a content-addressed object database. The data passed to Put
+// and returned by Get is a complete object including its "type size\0"
+// header; the store does not hash or validate it.
+type ObjectStore interface {
+	Has(hash string) (bool, error)
+	Get(hash string) ([]byte, error)
+	Put(hash string, data []byte) error
+	// Iterate calls fn once for every stored hash, stopping at the first error.
+	Iterate(fn func(hash string) error) error
+}
+
+// StreamStore is implemented by stores that can move object content through
+// readers, so that large blobs never have to fit in memory. Unlike Put,
+// PutStream hashes the object itself and returns its name.
+type StreamStore interface {
+	ObjectStore
+	PutStream(objType string, size int64, src io.Reader) (string, error)
+	// Open returns the object's type, content size and a reader of its content.
+	Open(hash string) (string, int64, io.ReadCloser, error)
+}
+
+// MemoryStore is an ObjectStore kept entirely in memory, mainly for tests.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewMemoryStore returns an empty in-memory object store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string][]byte)}
+}
+
+func (m *MemoryStore) Has(hash string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.objects[hash]
+	return ok, nil
+}
+
+func (m *MemoryStore) Get(hash string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.objects[hash]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", hash, ErrObjectNotFound)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *MemoryStore) Put(hash string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[hash] = append([]byte(nil), data...)
+	return nil
+}
+
+// Iterate visits hashes in sorted order.
+func (m *MemoryStore) Iterate(fn func(hash string) error) error {
+	m.mu.RLock()
+	hashes := make([]string, 0, len(m.objects))
+	for hash := range m.objects {
+		hashes = append(hashes, hash)
+	}
+	m.mu.RUnlock()
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		if err := fn(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes an object. Used by pruning.
+func (m *MemoryStore) Delete(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, hash)
+	return nil
+}
+
+// CachingStore wraps another store and keeps recently read objects in memory,
+// evicting the least recently used ones beyond maxBytes. Objects are
+// immutable, so cached data never goes stale; Has always asks the wrapped
+// store so that deletions by prune are seen.
+type CachingStore struct {
+	inner    ObjectStore
+	maxBytes int
+
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List // Front is most recently used
+}
+
+type cacheEntry struct {
+	hash string
+	data []byte
+}
+
+// NewCachingStore returns a read-through cache of at most maxBytes around inner.
+func NewCachingStore(inner ObjectStore, maxBytes int) *CachingStore {
+	return &CachingStore{
+		inner:    inner,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Unwrap returns the wrapped store.
+func (c *CachingStore) Unwrap() ObjectStore {
+	return c.inner
+}
+
+func (c *CachingStore) Has(hash string) (bool, error) {
+	return c.inner.Has(hash)
+}
+
+func (c *CachingStore) Get(hash string) ([]byte, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[hash]; ok {
+		c.lru.MoveToFront(elem)
+		data := elem.Value.(*cacheEntry).data
+		c.mu.Unlock()
+		return append([]byte(nil), data...), nil
+	}
+	c.mu.Unlock()
+
+	data, err := c.inner.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	c.add(hash, data)
+	return data, nil
+}
+
+func (c *CachingStore) Put(hash string, data []byte) error {
+	if err := c.inner.Put(hash, data); err != nil {
+		return err
+	}
+	c.add(hash, data)
+	return nil
+}
+
+func (c *CachingStore) Iterate(fn func(hash string) error) error {
+	return c.inner.Iterate(fn)
+}
+
+// Forget drops hash from the cache, e.g. after the object was deleted.
+func (c *CachingStore) Forget(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[hash]; ok {
+		c.remove(elem)
+	}
+}
+
+// Helper: Insert data, evicting from the back of the list to stay in budget
+func (c *CachingStore) add(hash string, data []byte) {
+	if len(data) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[hash]; ok {
+		return
+	}
+	c.entries[hash] = c.lru.PushFront(&cacheEntry{hash: hash, data: append([]byte(nil), data...)})
+	c.size += len(data)
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *CachingStore) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.hash)
+	c.size -= len(entry.data)
+}
@@ -0,0 +1,538 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Packs use git's pack format version 2 and index format version 2, so a
+// .gvc/objects/pack directory can be inspected with git verify-pack.
+
+const (
+	packObjCommit   = 1
+	packObjTree     = 2
+	packObjBlob     = 3
+	packObjTag      = 4
+	packObjOfsDelta = 6
+
+	packIdxLargeOffset = 0x80000000
+	maxDeltaDepth      = 50
+	deltaWindow        = 10
+)
+
+var (
+	packSignature = []byte("PACK")
+	idxSignature  = []byte{0xff, 't', 'O', 'c'}
+)
+
+var packObjTypes = map[string]int{"commit": packObjCommit, "tree": packObjTree, "blob": packObjBlob, "tag": packObjTag}
+
+// packFile is an opened pack index; object data is read from the pack on demand.
+type packFile struct {
+	packPath string
+	hashSize int
+	hashes   []byte   // Sorted binary object names, hashSize bytes each
+	offsets  []uint64 // Pack offset for each name
+}
+
+// packObject is an object queued for writing into a pack.
+type packObject struct {
+	hash  string
+	typ   string
+	name  string
+	size  int64
+	data  []byte // Content without the header, while in the delta window
+	base  *packObject
+	depth int
+
+	offset uint64
+	crc    uint32
+}
+
+// writePack packs the given objects into the pack directory and returns the
+// pack name and the number of objects stored as deltas. Blobs with the same
+// file name are stored as deltas where that saves space. Only the contents
+// of the objects inside the delta window are held in memory at a time.
+func (s *FileStore) writePack(objects map[string]reachableObject) (string, int, error) {
+	queue := make([]*packObject, 0, len(objects))
+	for hash, info := range objects {
+		// Opening reads no more than the header of most objects
+		_, size, content, err := s.Open(hash)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read object %s: %v", hash, err)
+		}
+		content.Close()
+		queue = append(queue, &packObject{hash: hash, typ: info.Type, name: info.Name, size: size})
+	}
+
+	// Like git, order by type, then name, then size descending so that
+	// similar objects sit next to each other and bases come first.
+	sort.Slice(queue, func(i, j int) bool {
+		a, b := queue[i], queue[j]
+		if a.typ != b.typ {
+			return packObjTypes[a.typ] < packObjTypes[b.typ]
+		}
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.size != b.size {
+			return a.size > b.size
+		}
+		return a.hash < b.hash
+	})
+
+	packDir := filepath.Join(s.dir, "pack")
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(packDir, ".tmp-pack-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	packHash := s.format.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, packHash)}
+	w := bufio.NewWriter(counter)
+
+	header := make([]byte, 12)
+	copy(header, packSignature)
+	binary.BigEndian.PutUint32(header[4:], 2)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(queue)))
+	w.Write(header)
+
+	deltas := 0
+	var window []*packObject
+	for _, obj := range queue {
+		data, err := s.Get(obj.hash)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read object %s: %v", obj.hash, err)
+		}
+		if _, obj.data, err = splitObject(data); err != nil {
+			return "", 0, fmt.Errorf("object %s: %v", obj.hash, err)
+		}
+		delta := findDeltaBase(obj, window)
+		if delta != nil {
+			deltas++
+		}
+		if err := writePackEntry(w, counter, obj, delta); err != nil {
+			return "", 0, err
+		}
+		window = append(window, obj)
+		if len(window) > deltaWindow {
+			window[0].data = nil // Only its offset is needed once it left the window
+			window = window[1:]
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return "", 0, err
+	}
+	checksum := packHash.Sum(nil)
+	if _, err := tmp.Write(checksum); err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	name := "pack-" + hex.EncodeToString(checksum)
+	if err := writeFileAtomic(filepath.Join(packDir, name+".idx"), buildPackIndex(queue, checksum, s.format), 0444); err != nil {
+		return "", 0, err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(packDir, name+".pack")); err != nil {
+		return "", 0, err
+	}
+	s.reloadPacks()
+	return name, deltas, nil
+}
+
+// Helper: Choose a delta base for a blob from the objects in the window with
+// the same name, returning the delta only when it is much smaller
+func findDeltaBase(obj *packObject, window []*packObject) []byte {
+	if obj.typ != "blob" || len(obj.data) < deltaBlockSize {
+		return nil
+	}
+	var best []byte
+	for j := len(window) - 1; j >= 0; j-- {
+		base := window[j]
+		if base.typ != obj.typ || base.name != obj.name {
+			break
+		}
+		if base.depth >= maxDeltaDepth {
+			continue
+		}
+		delta := computeDelta(base.data, obj.data)
+		if len(delta) < len(obj.data)/2 && (best == nil || len(delta) < len(best)) {
+			best = delta
+			obj.base = base
+		}
+	}
+	if best != nil {
+		obj.depth = obj.base.depth + 1
+	}
+	return best
+}
+
+// Helper: Append obj to the pack, as a delta against obj.base if delta is
+// set, recording its offset and CRC
+func writePackEntry(w *bufio.Writer, counter *countingWriter, obj *packObject, delta []byte) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	obj.offset = uint64(counter.n)
+
+	crc := crc32.NewIEEE()
+	entry := io.MultiWriter(w, crc)
+	payload := obj.data
+	if delta != nil {
+		payload = delta
+		entry.Write(encodePackHeader(packObjOfsDelta, len(payload)))
+		entry.Write(encodeOfsDelta(obj.offset - obj.base.offset))
+	} else {
+		entry.Write(encodePackHeader(packObjTypes[obj.typ], len(payload)))
+	}
+	zw := zlib.NewWriter(entry)
+	if _, err := zw.Write(payload); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	obj.crc = crc.Sum32()
+	return nil
+}
+
+// Helper: Build a version 2 pack index for the written objects
+func buildPackIndex(objects []*packObject, packChecksum []byte, format *ObjectFormat) []byte {
+	sorted := append([]*packObject(nil), objects...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].hash < sorted[j].hash })
+
+	var idx bytes.Buffer
+	idx.Write(idxSignature)
+	binary.Write(&idx, binary.BigEndian, uint32(2))
+
+	var fanout [256]uint32
+	for _, obj := range sorted {
+		first, _ := hex.DecodeString(obj.hash[:2])
+		fanout[first[0]]++
+	}
+	for i := 1; i < 256; i++ {
+		fanout[i] += fanout[i-1]
+	}
+	binary.Write(&idx, binary.BigEndian, fanout)
+
+	for _, obj := range sorted {
+		name, _ := hex.DecodeString(obj.hash)
+		idx.Write(name)
+	}
+	for _, obj := range sorted {
+		binary.Write(&idx, binary.BigEndian, obj.crc)
+	}
+	var large []uint64
+	for _, obj := range sorted {
+		if obj.offset < packIdxLargeOffset {
+			binary.Write(&idx, binary.BigEndian, uint32(obj.offset))
+			continue
+		}
+		binary.Write(&idx, binary.BigEndian, uint32(packIdxLargeOffset|len(large)))
+		large = append(large, obj.offset)
+	}
+	for _, offset := range large {
+		binary.Write(&idx, binary.BigEndian, offset)
+	}
+	idx.Write(packChecksum)
+	idx.Write(format.Sum(idx.Bytes()))
+	return idx.Bytes()
+}
+
+// Helper: Parse a version 2 pack index
+func readPackIndex(idxPath string, hashSize int) (*packFile, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	corrupt := func(reason string) error {
+		return fmt.Errorf("corrupt pack index %s: %s", idxPath, reason)
+	}
+	if len(data) < 8+256*4+2*hashSize || !bytes.Equal(data[:4], idxSignature) {
+		return nil, corrupt("bad header")
+	}
+	if version := binary.BigEndian.Uint32(data[4:]); version != 2 {
+		return nil, corrupt(fmt.Sprintf("unsupported version %d", version))
+	}
+	count := int(binary.BigEndian.Uint32(data[8+255*4:]))
+	namesAt := 8 + 256*4
+	crcAt := namesAt + count*hashSize
+	offsetsAt := crcAt + count*4
+	largeAt := offsetsAt + count*4
+	if len(data) < largeAt+2*hashSize {
+		return nil, corrupt("truncated")
+	}
+
+	pack := &packFile{
+		packPath: strings.TrimSuffix(idxPath, ".idx") + ".pack",
+		hashSize: hashSize,
+		hashes:   data[namesAt:crcAt],
+		offsets:  make([]uint64, count),
+	}
+	for i := range pack.offsets {
+		offset := binary.BigEndian.Uint32(data[offsetsAt+i*4:])
+		if offset&packIdxLargeOffset == 0 {
+			pack.offsets[i] = uint64(offset)
+			continue
+		}
+		at := largeAt + int(offset&^packIdxLargeOffset)*8
+		if at+8 > len(data) {
+			return nil, corrupt("bad large offset")
+		}
+		pack.offsets[i] = binary.BigEndian.Uint64(data[at:])
+	}
+	return pack, nil
+}
+
+// find returns the pack offset of hash.
+func (p *packFile) find(hash string) (uint64, bool) {
+	name, err := hex.DecodeString(hash)
+	if err != nil || len(name) != p.hashSize {
+		return 0, false
+	}
+	count := len(p.offsets)
+	i := sort.Search(count, func(i int) bool {
+		return bytes.Compare(p.hashes[i*p.hashSize:(i+1)*p.hashSize], name) >= 0
+	})
+	if i < count && bytes.Equal(p.hashes[i*p.hashSize:(i+1)*p.hashSize], name) {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// findPrefix returns the names in the pack starting with the hex prefix.
+func (p *packFile) findPrefix(prefix string) []string {
+	// An odd prefix is searched for with its last digit as the high nibble
+	low, err := hex.DecodeString(prefix + strings.Repeat("0", len(prefix)%2))
+	if err != nil {
+		return nil
+	}
+	count := len(p.offsets)
+	i := sort.Search(count, func(i int) bool {
+		return bytes.Compare(p.hashes[i*p.hashSize:(i+1)*p.hashSize], low) >= 0
+	})
+	var names []string
+	for ; i < count; i++ {
+		name := hex.EncodeToString(p.hashes[i*p.hashSize : (i+1)*p.hashSize])
+		if !strings.HasPrefix(name, prefix) {
+			break
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// names returns every object name in the pack as hex.
+func (p *packFile) names() []string {
+	names := make([]string, len(p.offsets))
+	for i := range names {
+		names[i] = hex.EncodeToString(p.hashes[i*p.hashSize : (i+1)*p.hashSize])
+	}
+	return names
+}
+
+// readObject returns the object at offset with its "type size\0" header.
+func (p *packFile) readObject(offset uint64) ([]byte, error) {
+	f, err := os.Open(p.packPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	typ, content, err := readPackEntry(f, offset, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s at offset %d: %v", filepath.Base(p.packPath), offset, err)
+	}
+	header := fmt.Sprintf("%s %d\x00", typ, len(content))
+	return append([]byte(header), content...), nil
+}
+
+// openObject streams the content of the object at offset. Deltified objects
+// have to be rebuilt from their base and are read into memory.
+func (p *packFile) openObject(offset uint64) (string, int64, io.ReadCloser, error) {
+	f, err := os.Open(p.packPath)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, int64(offset), 1<<62))
+	typ, size, err := decodePackHeader(r)
+	if err == nil && typ != packObjOfsDelta {
+		name, err := packTypeName(typ)
+		if err != nil {
+			f.Close()
+			return "", 0, nil, err
+		}
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			f.Close()
+			return "", 0, nil, fmt.Errorf("%s at offset %d: %v", filepath.Base(p.packPath), offset, err)
+		}
+		closeFn := func() error {
+			zr.Close()
+			return f.Close()
+		}
+		return name, int64(size), &readCloser{Reader: io.LimitReader(zr, int64(size)), close: closeFn}, nil
+	}
+	f.Close()
+
+	data, err := p.readObject(offset)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	name, content, err := splitObject(data)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return name, int64(len(content)), io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// Helper: Read and inflate the entry at offset, resolving delta chains
+func readPackEntry(f *os.File, offset uint64, depth int) (string, []byte, error) {
+	if depth > maxDeltaDepth*2 {
+		return "", nil, errors.New("delta chain too deep")
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, int64(offset), 1<<62))
+	typ, size, err := decodePackHeader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	var baseOffset uint64
+	if typ == packObjOfsDelta {
+		rel, err := decodeOfsDelta(r)
+		if err != nil {
+			return "", nil, err
+		}
+		if rel == 0 || rel > offset {
+			return "", nil, errors.New("bad delta base offset")
+		}
+		baseOffset = offset - rel
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(zr, payload); err != nil {
+		return "", nil, err
+	}
+
+	if typ != packObjOfsDelta {
+		name, err := packTypeName(typ)
+		return name, payload, err
+	}
+	baseType, base, err := readPackEntry(f, baseOffset, depth+1)
+	if err != nil {
+		return "", nil, err
+	}
+	content, err := applyDelta(base, payload)
+	return baseType, content, err
+}
+
+// Helper: Pack entry header, type in bits 4-6 of the first byte and the size
+// as a little-endian base-128 number
+func encodePackHeader(typ, size int) []byte {
+	b := byte(typ<<4) | byte(size&0x0f)
+	size >>= 4
+	var out []byte
+	for size > 0 {
+		out = append(out, b|0x80)
+		b = byte(size & 0x7f)
+		size >>= 7
+	}
+	return append(out, b)
+}
+
+func decodePackHeader(r io.ByteReader) (int, int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ := int(b>>4) & 7
+	size := int(b & 0x0f)
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, err
+		}
+		size |= int(b&0x7f) << shift
+	}
+	return typ, size, nil
+}
+
+// Helper: Negative offset to an OFS_DELTA base, big-endian with the
+// "add one per continuation byte" encoding git uses
+func encodeOfsDelta(offset uint64) []byte {
+	out := []byte{byte(offset & 0x7f)}
+	for offset >>= 7; offset > 0; offset >>= 7 {
+		offset--
+		out = append([]byte{byte(0x80 | offset&0x7f)}, out...)
+	}
+	return out
+}
+
+func decodeOfsDelta(r io.ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	offset := uint64(b & 0x7f)
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		offset = ((offset + 1) << 7) | uint64(b&0x7f)
+	}
+	return offset, nil
+}
+
+// Helper: Object type name of a pack entry type
+func packTypeName(typ int) (string, error) {
+	for name, t := range packObjTypes {
+		if t == typ {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported object type %d", typ)
+}
+
+// Helper: Split "type size\0content" object data
+func splitObject(data []byte) (string, []byte, error) {
+	parts := bytes.SplitN(data, []byte{0}, 2)
+	if len(parts) != 2 {
+		return "", nil, errors.New("missing object header")
+	}
+	typ, _, _ := strings.Cut(string(parts[0]), " ")
+	return typ, parts[1], nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPruneExpire is used when gc.pruneExpire is not configured.
+const DefaultPruneExpire = "2.weeks.ago"
+
+// PrunedObject is an unreachable loose object removed (or, in a dry run, that
+// would be removed) by Prune.
+type PrunedObject struct {
+	Hash    string
+	Type    string
+	ModTime time.Time
+}
+
+// Prune deletes unreachable loose objects last modified before cutoff. The
+// grace period protects objects written by a command that is still running,
+// such as blobs from an add that has not updated the index yet. With dryRun
+// set nothing is deleted.
+func (r *Repo) Prune(cutoff time.Time, dryRun bool) ([]PrunedObject, error) {
+	store, err := r.fileStore()
+	if err != nil {
+		return nil, err
+	}
+	reachable, err := r.reachableObjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk reachable objects: %v", err)
+	}
+	loose, err := store.looseObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []PrunedObject
+	for _, hash := range loose {
+		if _, ok := reachable[hash]; ok {
+			continue
+		}
+		info, err := os.Stat(store.loosePath(hash))
+		if err != nil {
+			return pruned, err
+		}
+		if !info.ModTime().Before(cutoff) {
+			continue
+		}
+		object := PrunedObject{Hash: hash, ModTime: info.ModTime()}
+		if data, err := store.readLoose(hash); err == nil {
+			object.Type, _, _ = splitObject(data)
+		}
+		if !dryRun {
+			if err := store.Delete(hash); err != nil {
+				return pruned, err
+			}
+			if cache, ok := r.Objects.(*CachingStore); ok {
+				cache.Forget(hash)
+			}
+		}
+		pruned = append(pruned, object)
+	}
+	return pruned, nil
+}
+
+// PruneCutoff returns the cutoff for Prune from expire, or from
+// gc.pruneExpire when expire is empty.
+func (r *Repo) PruneCutoff(expire string, now time.Time) (time.Time, error) {
+	if expire == "" {
+		expire = DefaultPruneExpire
+		if value, ok := r.Config.Get("gc.pruneexpire"); ok {
+			expire = value
+		}
+	}
+	return ParseExpiry(expire, now)
+}
+
+// ParseExpiry parses an expiry such as "now", "never", "2.weeks.ago",
+// "3 days ago" or a Go duration like "36h" into an absolute cutoff time.
+// "never" yields the zero time, which nothing is older than.
+func ParseExpiry(expire string, now time.Time) (time.Time, error) {
+	value := strings.ToLower(strings.TrimSpace(expire))
+	switch value {
+	case "now":
+		return now, nil
+	case "never":
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == '.' || r == ' ' })
+	if len(fields) == 3 && fields[2] == "ago" {
+		n, err := strconv.Atoi(fields[0])
+		if err == nil && n >= 0 {
+			unit := strings.TrimSuffix(fields[1], "s")
+			switch unit {
+			case "second":
+				return now.Add(-time.Duration(n) * time.Second), nil
+			case "minute":
+				return now.Add(-time.Duration(n) * time.Minute), nil
+			case "hour":
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case "day":
+				return now.AddDate(0, 0, -n), nil
+			case "week":
+				return now.AddDate(0, 0, -7*n), nil
+			case "month":
+				return now.AddDate(0, -n, 0), nil
+			case "year":
+				return now.AddDate(-n, 0, 0), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry '%s'", expire)
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"fmt"
+	"path"
+)
+
+// reachableObject is an object found while walking from the refs.
+type reachableObject struct {
+	Type string // "commit", "tag", "tree", "blob" or "chunks"
+	Name string // Base name of the file for blobs, used to pick delta bases
+}
+
+// reachableObjects walks history from every ref, HEAD, the reflogs and the
+// index and returns all objects that are still in use.
+func (r *Repo) reachableObjects() (map[string]reachableObject, error) {
+	objects := make(map[string]reachableObject)
+
+	refs, err := r.ListRefs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %v", err)
+	}
+	head, err := r.getCurrentCommit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %v", err)
+	}
+	tips := []string{head}
+	for _, hash := range refs {
+		tips = append(tips, hash)
+	}
+	reflogs, err := r.reflogLinks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reflogs: %v", err)
+	}
+	for _, link := range reflogs {
+		// Entries may name commits that were pruned before reflogs kept them
+		if r.HasObject(link.to) {
+			tips = append(tips, link.to)
+		}
+	}
+
+	for _, tip := range tips {
+		if tip == "" {
+			continue
+		}
+		// Tags keep their tag objects and whatever they tag
+		hash, typ, err := r.peelTags(tip, objects)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case "tree":
+			if err := r.walkTree(hash, objects); err != nil {
+				return nil, err
+			}
+			continue
+		case "blob", "chunks":
+			if err := r.addFileObject(hash, typ, "", objects); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for hash != "" {
+			if _, seen := objects[hash]; seen {
+				break
+			}
+			commit, err := r.GetCommit(hash)
+			if err != nil {
+				return nil, err
+			}
+			objects[hash] = reachableObject{Type: "commit"}
+			if err := r.walkTree(commit.Tree, objects); err != nil {
+				return nil, err
+			}
+			hash = commit.Parent
+		}
+	}
+
+	index, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	for _, entry := range *index {
+		if err := r.addFileObject(entry.BlobHash, entry.ObjectType(), path.Base(entry.Path), objects); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// Helper: Add a tree and everything below it to objects
+func (r *Repo) walkTree(hash string, objects map[string]reachableObject) error {
+	if _, seen := objects[hash]; seen {
+		return nil
+	}
+	tree, err := r.GetTree(hash)
+	if err != nil {
+		return err
+	}
+	objects[hash] = reachableObject{Type: "tree"}
+	for _, entry := range tree {
+		switch entry.Type {
+		case "tree":
+			if err := r.walkTree(entry.Hash, objects); err != nil {
+				return err
+			}
+		default:
+			if err := r.addFileObject(entry.Hash, entry.Type, entry.Path, objects); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Helper: Add a file's object to objects, with its chunks if it is chunked
+func (r *Repo) addFileObject(hash, typ, name string, objects map[string]reachableObject) error {
+	if _, seen := objects[hash]; seen {
+		return nil
+	}
+	objects[hash] = reachableObject{Type: typ, Name: name}
+	if typ != "chunks" {
+		return nil
+	}
+	data, err := r.GetObjectContent(hash)
+	if err != nil {
+		return err
+	}
+	_, content, err := splitObject(data)
+	if err != nil {
+		return fmt.Errorf("object %s: %v", hash, err)
+	}
+	chunks, err := parseChunkList(hash, content)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if _, seen := objects[chunk.Hash]; !seen {
+			objects[chunk.Hash] = reachableObject{Type: "blob", Name: name}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every change to HEAD or a branch is appended to its reflog in .gvc/logs,
+// in git's format:
+//
+//	<old hash> <new hash> <name> <unix time> +0000\t<message>
+//
+// The old hash is all zeros when the ref was created. Reflogs are what
+// revisions like main@{1} are looked up in, so every commit they name is kept
+// by prune and gc, as in git.
+
+// ReflogEntry is one change of a ref.
+type ReflogEntry struct {
+	Old     string // Empty when the ref was created
+	New     string
+	Name    string
+	Date    time.Time
+	Message string
+}
+
+// Reflog returns the changes of HEAD, a branch or a full ref name, newest
+// first, or of the current branch if name is empty. It is empty if the ref
+// has no reflog.
+func (r *Repo) Reflog(name string) ([]ReflogEntry, error) {
+	refPath, err := r.reflogRef(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.readReflog(refPath)
+}
+
+// Helper: The changes of refPath (e.g. "refs/heads/main"), newest first
+func (r *Repo) readReflog(refPath string) ([]ReflogEntry, error) {
+	file, err := os.Open(r.gvcPath("logs", refPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, message, _ := strings.Cut(scanner.Text(), "\t")
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("invalid reflog entry for %s: %s", refPath, scanner.Text())
+		}
+		timestamp, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reflog timestamp for %s: %s", refPath, scanner.Text())
+		}
+		entry := ReflogEntry{
+			Old:     fields[0],
+			New:     fields[1],
+			Name:    strings.Join(fields[2:len(fields)-2], " "),
+			Date:    time.Unix(timestamp, 0),
+			Message: message,
+		}
+		if strings.Trim(entry.Old, "0") == "" {
+			entry.Old = ""
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// Helper: The commits named by any reflog entry, old and new, as links from
+// the reflog that names them
+func (r *Repo) reflogLinks() ([]objectLink, error) {
+	var links []objectLink
+	logsDir := r.gvcPath("logs")
+	err := filepath.WalkDir(logsDir, func(logPath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		refPath, err := filepath.Rel(logsDir, logPath)
+		if err != nil {
+			return err
+		}
+		entries, err := r.readReflog(filepath.ToSlash(refPath))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			for _, hash := range []string{entry.Old, entry.New} {
+				if hash != "" {
+					links = append(links, objectLink{from: "reflog of " + filepath.ToSlash(refPath), to: hash, wantType: "commit"})
+				}
+			}
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return links, err
+}
+
+// Helper: Append a change of refPath from oldHash ("" if it is new) to
+// newHash to its reflog
+func (r *Repo) appendReflog(refPath, oldHash, newHash, message string) error {
+	if oldHash == "" {
+		oldHash = strings.Repeat("0", r.Format.HexSize())
+	}
+	logPath := r.gvcPath("logs", refPath)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return fmt.Errorf("failed to write reflog of %s: %v", refPath, err)
+	}
+	file, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write reflog of %s: %v", refPath, err)
+	}
+	defer file.Close()
+	// One write, so that entries appended at the same time do not interleave
+	line := fmt.Sprintf("%s %s %s %d +0000\t%s\n", oldHash, newHash, reflogName(), time.Now().Unix(), strings.ReplaceAll(message, "\n", " "))
+	if _, err := file.WriteString(line); err != nil {
+		return fmt.Errorf("failed to write reflog of %s: %v", refPath, err)
+	}
+	return nil
+}
+
+// Helper: Record a move of HEAD, and of the branch it points to unless it is
+// detached, in their reflogs
+func (r *Repo) logHeadMove(refPath, oldHash, newHash, message string) error {
+	if refPath != "" {
+		if err := r.appendReflog(refPath, oldHash, newHash, message); err != nil {
+			return err
+		}
+	}
+	return r.appendReflog("HEAD", oldHash, newHash, message)
+}
+
+// Helper: The ref whose reflog name refers to: HEAD, a branch, a full ref
+// name, or when empty the current branch (HEAD when detached)
+func (r *Repo) reflogRef(name string) (string, error) {
+	switch {
+	case name == "HEAD":
+		return "HEAD", nil
+	case name == "":
+		refPath, _, err := r.readHead()
+		if err != nil || refPath == "" {
+			return "HEAD", err
+		}
+		return refPath, nil
+	case strings.HasPrefix(name, "refs/"):
+		return name, checkRefName(name)
+	}
+	return "refs/heads/" + name, checkRefName(name)
+}
+
+// Helper: Who changes refs, the user running gvc
+func reflogName() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return "unknown"
+}
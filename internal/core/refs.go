@@ -0,0 +1,40 @@
+package core
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ListRefs returns every ref under .gvc/refs (e.g. "refs/heads/main") mapped to
+// the hash it points to. Refs of branches without commits are skipped.
+func (r *Repo) ListRefs() (map[string]string, error) {
+	refs := make(map[string]string)
+	err := filepath.WalkDir(r.gvcPath("refs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".lock") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hash := strings.TrimSpace(string(data))
+		if hash == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(r.GvcDir, path)
+		if err != nil {
+			return err
+		}
+		refs[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
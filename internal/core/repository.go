@@ -1,23 +1,179 @@
 package core
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GvcDirName is the name of the metadata directory at the top of a work tree.
+const GvcDirName = ".gvc"
+
+// Repository format versions, recorded as core.repositoryformatversion.
+// Version 0 repositories (no config file) store objects uncompressed; version 1
+// stores them zlib-deflated as git does.
+const (
+	formatVersionUncompressed = 0
+	formatVersionCompressed   = 1
+	currentFormatVersion      = formatVersionCompressed
+)
+
+// ErrNotARepository is returned when no enclosing .gvc directory can be found.
+var ErrNotARepository = errors.New("not a gvc repository (or any of the parent directories)")
+
+// Repo is a gvc repository: a work tree and the .gvc directory holding its metadata.
+type Repo struct {
+	WorkTree string        // Absolute path to the top of the working tree
+	GvcDir   string        // Absolute path to the .gvc directory
+	Config   *Config       // Contents of .gvc/config
+	Format   *ObjectFormat // Hash algorithm naming objects, fixed at init
+
+	// Objects holds blobs, trees and commits. Repositories opened from disk
+	// use a cached FileStore on .gvc/objects.
+	Objects ObjectStore
+}
+
+// Size of the read cache in front of .gvc/objects
+const objectCacheSize = 32 << 20
+
+// InitRepo creates a new repository in dir whose objects are named with
+// format, and returns it.
+func InitRepo(dir string, format *ObjectFormat) (*Repo, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &Repo{WorkTree: abs, GvcDir: filepath.Join(abs, GvcDirName), Format: format}
 
-func InitRepo() error {
 	// Create .gvc and subdirectories
-	dirs := []string{".gvc", ".gvc/objects", ".gvc/refs", ".gvc/refs/heads"}
+	dirs := []string{r.GvcDir, r.gvcPath("objects"), r.gvcPath("refs"), r.gvcPath("refs", "heads")}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			return err
+			return nil, err
+		}
+	}
+
+	if err := writeLocked(r.gvcPath("HEAD"), []byte("ref: refs/heads/main"), 0644); err != nil {
+		return nil, err
+	}
+
+	if err := writeLocked(r.gvcPath("refs", "heads", "main"), []byte{}, 0644); err != nil {
+		return nil, err
+	}
+
+	if err := r.SaveIndex(&Index{}); err != nil {
+		return nil, err
+	}
+
+	r.Config = &Config{}
+	r.Config.Set("core.repositoryformatversion", fmt.Sprint(currentFormatVersion))
+	if format != SHA1 {
+		r.Config.Set("extensions.objectformat", format.Name)
+	}
+	if err := r.SaveConfig(); err != nil {
+		return nil, err
+	}
+	r.Objects = r.defaultObjectStore()
+	return r, nil
+}
+
+// FindRepo walks up from start until it finds a directory containing .gvc.
+func FindRepo(start string) (*Repo, error) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if isGvcDir(filepath.Join(dir, GvcDirName)) {
+			return openRepo(dir, filepath.Join(dir, GvcDirName))
 		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotARepository
+		}
+		dir = parent
 	}
-	err := os.WriteFile(".gvc/index.json", []byte{}, 0644)
+}
+
+// OpenRepo opens the repository whose metadata lives in gvcDir. The work tree
+// is the directory containing gvcDir.
+func OpenRepo(gvcDir string) (*Repo, error) {
+	abs, err := filepath.Abs(gvcDir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !isGvcDir(abs) {
+		return nil, fmt.Errorf("%s: %w", gvcDir, ErrNotARepository)
+	}
+	return openRepo(filepath.Dir(abs), abs)
+}
+
+// Helper: Load the configuration and check the repository format is supported
+func openRepo(workTree, gvcDir string) (*Repo, error) {
+	r := &Repo{WorkTree: workTree, GvcDir: gvcDir}
+	if err := r.loadConfig(); err != nil {
+		return nil, err
 	}
+	if version := r.FormatVersion(); version > currentFormatVersion {
+		return nil, fmt.Errorf("unsupported repository format version %d (this gvc supports up to %d)", version, currentFormatVersion)
+	}
+	value, _ := r.Config.Get("extensions.objectformat")
+	format, err := LookupObjectFormat(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", gvcDir, err)
+	}
+	r.Format = format
+	r.Objects = r.defaultObjectStore()
+	return r, nil
+}
+
+// Helper: A cached FileStore on .gvc/objects
+func (r *Repo) defaultObjectStore() ObjectStore {
+	compress := r.FormatVersion() >= formatVersionCompressed
+	return NewCachingStore(NewFileStore(r.gvcPath("objects"), r.Format, compress), objectCacheSize)
+}
 
-	if err := os.WriteFile(".gvc/HEAD", []byte("ref: refs/heads/main"), 0644); err != nil {
-		return err
+// FormatVersion returns core.repositoryformatversion, 0 if it is not set.
+func (r *Repo) FormatVersion() int {
+	value, ok := r.Config.Get("core.repositoryformatversion")
+	if !ok {
+		return formatVersionUncompressed
 	}
+	var version int
+	fmt.Sscan(value, &version)
+	return version
+}
+
+// RelPath converts a path given relative to the current directory (or an
+// absolute path) into a slash-separated path relative to the work tree.
+func (r *Repo) RelPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(r.WorkTree, abs)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside repository at %s", path, r.WorkTree)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Helper: Path to a file inside the .gvc directory
+func (r *Repo) gvcPath(elem ...string) string {
+	return filepath.Join(append([]string{r.GvcDir}, elem...)...)
+}
+
+// Helper: Absolute path of a repo-relative, slash-separated path
+func (r *Repo) workPath(path string) string {
+	return filepath.Join(r.WorkTree, filepath.FromSlash(path))
+}
 
-	return os.WriteFile(".gvc/refs/heads/main", []byte{}, 0644)
+func isGvcDir(path string) bool {
+	info, err := os.Stat(filepath.Join(path, "HEAD"))
+	return err == nil && !info.IsDir()
 }
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ResetMode selects what Reset makes match the commit besides the branch.
+type ResetMode int
+
+const (
+	ResetMixed ResetMode = iota // The index, leaving the working directory alone
+	ResetSoft                   // Nothing, only the branch moves
+	ResetHard                   // The index and the working directory, discarding local changes
+)
+
+// Reset points the current branch, or HEAD when detached, at the commit rev
+// names and returns its hash. Depending on mode the index and the working
+// directory are made to match it too.
+func (r *Repo) Reset(rev string, mode ResetMode) (string, error) {
+	if err := r.checkNoInterruptedCheckout(); err != nil {
+		return "", err
+	}
+	commitHash, err := r.ResolveCommit(rev)
+	if err != nil {
+		return "", err
+	}
+	refPath, oldCommit, err := r.readHead()
+	if err != nil {
+		return "", err
+	}
+	switch mode {
+	case ResetMixed:
+		err = r.resetIndex(commitHash)
+	case ResetHard:
+		err = r.checkoutCommit(commitHash, "", true)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	target := refPath
+	if target == "" {
+		target = "HEAD"
+	}
+	if err := r.updateRef(target, commitHash, oldCommit); err != nil {
+		return "", err
+	}
+	return commitHash, r.logHeadMove(refPath, oldCommit, commitHash, "reset: moving to "+rev)
+}
+
+// Helper: Make the index match the tree of commitHash. Entries that do not
+// change keep their stat data, the others are hashed again by the next scan.
+func (r *Repo) resetIndex(commitHash string) error {
+	commit, err := r.GetCommit(commitHash)
+	if err != nil {
+		return fmt.Errorf("failed to get commit: %v", err)
+	}
+	treeFiles, err := r.GetTreeEntries(commit.Tree)
+	if err != nil {
+		return fmt.Errorf("failed to get tree files: %v", err)
+	}
+	lock, err := r.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+	index, err := r.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+
+	staged := make(map[string]IndexEntry, len(*index))
+	for _, entry := range *index {
+		staged[entry.Path] = entry
+	}
+	newIndex := make(Index, 0, len(treeFiles))
+	for path, treeEntry := range treeFiles {
+		if entry, ok := staged[path]; ok && entry.BlobHash == treeEntry.Hash && entry.Type == treeEntry.Mode {
+			newIndex = append(newIndex, entry)
+			continue
+		}
+		newIndex = append(newIndex, IndexEntry{Path: path, BlobHash: treeEntry.Hash, Type: treeEntry.Mode, ObjType: treeObjType(treeEntry)})
+	}
+	sort.Slice(newIndex, func(i, j int) bool { return newIndex[i].Path < newIndex[j].Path })
+	if err := r.writeIndex(lock, &newIndex); err != nil {
+		return fmt.Errorf("failed to save index: %v", err)
+	}
+	return nil
+}
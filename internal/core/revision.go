@@ -0,0 +1,354 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// A revision names an object much like it does in git:
+//
+//	HEAD, @               the current commit
+//	main, v1.0, refs/...  a branch, a tag or a full ref name
+//	3f9a2c1               an object by a unique prefix of its hash
+//	main@{2}, @{1}        the value a ref had n changes ago, from its reflog;
+//	                      without a name, of the current branch
+//	<rev>~3               the third ancestor, ~ alone is ~1
+//	<rev>^1, <rev>^       the first parent; ^0 is the commit itself
+//	<rev>^{tree}, ^{}     the object peeled to a type, or tags followed
+//	<rev>:path            the blob or tree at path in the commit's tree
+//	:path                 the blob staged for path
+//
+// Ranges of history are written a..b for the commits reachable from b but
+// not from a, and a...b for those reachable from either but not both. An
+// omitted side stands for HEAD.
+
+// Hash prefixes shorter than this are not looked up
+const minAbbrev = 4
+
+var (
+	// ErrUnknownRevision is returned for a revision that names nothing.
+	ErrUnknownRevision = errors.New("unknown revision")
+
+	// ErrAmbiguousRevision is returned for a hash prefix that matches more
+	// than one object.
+	ErrAmbiguousRevision = errors.New("ambiguous revision")
+)
+
+// RevisionRange is a range of history, see ParseRange.
+type RevisionRange struct {
+	From      string
+	To        string
+	Symmetric bool // From...To rather than From..To
+}
+
+// ParseRange splits "from..to" or "from...to" into a RevisionRange, with
+// HEAD for an omitted side. It reports false if expr is a single revision.
+func ParseRange(expr string) (RevisionRange, bool) {
+	// Paths may contain dots, as in HEAD:v1..v2.txt
+	if strings.Contains(expr, ":") {
+		return RevisionRange{}, false
+	}
+	var rng RevisionRange
+	from, to, found := strings.Cut(expr, "...")
+	if found {
+		rng.Symmetric = true
+	} else if from, to, found = strings.Cut(expr, ".."); !found {
+		return rng, false
+	}
+	rng.From, rng.To = from, to
+	if rng.From == "" {
+		rng.From = "HEAD"
+	}
+	if rng.To == "" {
+		rng.To = "HEAD"
+	}
+	return rng, true
+}
+
+// ResolveRevision returns the object rev names and its type.
+func (r *Repo) ResolveRevision(rev string) (string, string, error) {
+	var hash string
+	var err error
+	if spec, relPath, found := strings.Cut(rev, ":"); found {
+		hash, err = r.resolvePath(rev, spec, relPath)
+	} else {
+		hash, err = r.resolveSuffixes(rev)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	typ, err := r.objectType(hash)
+	if err != nil {
+		return "", "", err
+	}
+	return hash, typ, nil
+}
+
+// ResolveCommit returns the commit rev names, following annotated tags to
+// what they tag.
+func (r *Repo) ResolveCommit(rev string) (string, error) {
+	hash, _, err := r.ResolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+	return r.peelTo(hash, "commit", rev)
+}
+
+// Helper: Resolve a name followed by any number of ~n, ^n and ^{type}
+func (r *Repo) resolveSuffixes(rev string) (string, error) {
+	// Ref names cannot contain ~ or ^, so the first one ends the name
+	end := strings.IndexAny(rev, "~^")
+	if end < 0 {
+		end = len(rev)
+	}
+	hash, err := r.resolveName(rev[:end])
+	if err != nil {
+		return "", err
+	}
+	for suffix := rev[end:]; suffix != ""; {
+		op := suffix[0]
+		suffix = suffix[1:]
+		if op != '~' && op != '^' {
+			return "", fmt.Errorf("invalid revision '%s'", rev)
+		}
+		if op == '^' && strings.HasPrefix(suffix, "{") {
+			brace := strings.IndexByte(suffix, '}')
+			if brace < 0 {
+				return "", fmt.Errorf("invalid revision '%s': missing '}'", rev)
+			}
+			want := suffix[1:brace]
+			suffix = suffix[brace+1:]
+			if want == "" {
+				hash, _, err = r.peelTags(hash, nil)
+			} else {
+				hash, err = r.peelTo(hash, want, rev)
+			}
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		n := 1
+		if digits := digitRun(suffix); digits > 0 {
+			if n, err = strconv.Atoi(suffix[:digits]); err != nil {
+				return "", fmt.Errorf("invalid revision '%s': %v", rev, err)
+			}
+			suffix = suffix[digits:]
+		}
+		if hash, err = r.peelTo(hash, "commit", rev); err != nil {
+			return "", err
+		}
+		// gvc commits have one parent at most
+		if op == '^' && n > 1 {
+			return "", fmt.Errorf("%w '%s': commit %s has no parent %d", ErrUnknownRevision, rev, hash[:7], n)
+		}
+		for ; n > 0; n-- {
+			commit, err := r.GetCommit(hash)
+			if err != nil {
+				return "", err
+			}
+			if commit.Parent == "" {
+				return "", fmt.Errorf("%w '%s': commit %s has no parent", ErrUnknownRevision, rev, hash[:7])
+			}
+			hash = commit.Parent
+		}
+	}
+	return hash, nil
+}
+
+// Helper: The hash name refers to, before following tags: HEAD, a hash, a
+// ref, a reflog entry or a hash prefix
+func (r *Repo) resolveName(name string) (string, error) {
+	if ref, selector, found := strings.Cut(name, "@{"); found {
+		return r.resolveReflog(name, ref, selector)
+	}
+	if name == "HEAD" || name == "@" {
+		hash, err := r.getCurrentCommit()
+		if err != nil {
+			return "", fmt.Errorf("failed to read HEAD: %v", err)
+		}
+		if hash == "" {
+			return "", fmt.Errorf("HEAD does not point to a commit yet")
+		}
+		return hash, nil
+	}
+	if r.Format.IsValidHash(name) && r.HasObject(name) {
+		return name, nil
+	}
+	if checkRefName(name) == nil {
+		for _, ref := range []string{name, "refs/heads/" + name, "refs/tags/" + name} {
+			// A directory, as for "release" next to a tag "release/v1", is no ref
+			if info, err := os.Stat(r.gvcPath(ref)); !strings.HasPrefix(ref, "refs/") || err != nil || info.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(r.gvcPath(ref))
+			if err != nil {
+				return "", err
+			}
+			if hash := strings.TrimSpace(string(data)); hash != "" {
+				return hash, nil
+			}
+		}
+	}
+	hash, err := r.expandHash(name)
+	if err != nil {
+		return "", err
+	}
+	if hash == "" {
+		return "", fmt.Errorf("%w '%s'", ErrUnknownRevision, name)
+	}
+	return hash, nil
+}
+
+// Helper: The value ref had n changes ago, for the selector "n}" of
+// "ref@{n}"
+func (r *Repo) resolveReflog(rev, ref, selector string) (string, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(selector, "}"))
+	if !strings.HasSuffix(selector, "}") || err != nil || n < 0 {
+		return "", fmt.Errorf("invalid revision '%s': only @{n} with a number of changes is supported", rev)
+	}
+	refPath, err := r.reflogRef(ref)
+	if err != nil {
+		return "", err
+	}
+	entries, err := r.readReflog(refPath)
+	if err != nil {
+		return "", err
+	}
+	if n >= len(entries) {
+		return "", fmt.Errorf("%w '%s': the reflog of %s has only %d entries", ErrUnknownRevision, rev, refPath, len(entries))
+	}
+	return entries[n].New, nil
+}
+
+// Helper: The object with a hash starting with prefix, "" if prefix is no
+// hash prefix or matches nothing
+func (r *Repo) expandHash(prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < minAbbrev || len(prefix) > r.Format.HexSize() || strings.Trim(prefix, "0123456789abcdef") != "" {
+		return "", nil
+	}
+	var matches []string
+	if store, err := r.fileStore(); err == nil {
+		if matches, err = store.findPrefix(prefix); err != nil {
+			return "", err
+		}
+	} else {
+		err := r.Objects.Iterate(func(hash string) error {
+			if strings.HasPrefix(hash, prefix) {
+				matches = append(matches, hash)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(matches) <= 1 {
+		return strings.Join(matches, ""), nil
+	}
+	candidates := make([]string, len(matches))
+	for i, hash := range matches {
+		typ, err := r.objectType(hash)
+		if err != nil {
+			typ = "unknown"
+		}
+		candidates[i] = hash + " " + typ
+	}
+	return "", fmt.Errorf("%w: short hash '%s' matches\n\t%s", ErrAmbiguousRevision, prefix, strings.Join(candidates, "\n\t"))
+}
+
+// Helper: The object at relPath in the tree of the commit spec names, or
+// with an empty spec the blob staged for relPath
+func (r *Repo) resolvePath(rev, spec, relPath string) (string, error) {
+	relPath = strings.Trim(path.Clean("/"+relPath), "/")
+	if spec == "" {
+		index, err := r.LoadIndex()
+		if err != nil {
+			return "", fmt.Errorf("failed to load index: %w", err)
+		}
+		entry, ok := index.GetEntry(relPath)
+		if !ok {
+			return "", fmt.Errorf("%w '%s': '%s' is not in the index", ErrUnknownRevision, rev, relPath)
+		}
+		return entry.BlobHash, nil
+	}
+
+	hash, err := r.resolveSuffixes(spec)
+	if err != nil {
+		return "", err
+	}
+	hash, err = r.peelTo(hash, "tree", spec)
+	if err != nil || relPath == "" {
+		return hash, err
+	}
+	names := strings.Split(relPath, "/")
+	for i, name := range names {
+		entries, err := r.GetTree(hash)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, entry := range entries {
+			// Only the last name may be a file
+			if entry.Path == name && (i == len(names)-1 || entry.Type == "tree") {
+				hash, found = entry.Hash, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%w '%s': path '%s' does not exist in '%s'", ErrUnknownRevision, rev, relPath, spec)
+		}
+	}
+	return hash, nil
+}
+
+// Helper: Follow hash to an object of type want: tags to what they tag and
+// commits to their tree
+func (r *Repo) peelTo(hash, want, rev string) (string, error) {
+	for {
+		typ, err := r.objectType(hash)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case typ == want:
+			return hash, nil
+		case typ == "tag":
+			tag, err := r.GetTag(hash)
+			if err != nil {
+				return "", err
+			}
+			hash = tag.Object
+		case typ == "commit" && want == "tree":
+			commit, err := r.GetCommit(hash)
+			if err != nil {
+				return "", err
+			}
+			hash = commit.Tree
+		default:
+			return "", fmt.Errorf("'%s' is a %s, not a %s", rev, typ, want)
+		}
+	}
+}
+
+// Helper: The newest commit reachable from both a and b, "" if none is
+func (r *Repo) mergeBase(a, b string) (string, error) {
+	fromA, err := r.ancestors(a)
+	if err != nil {
+		return "", err
+	}
+	for b != "" && !fromA[b] {
+		commit, err := r.GetCommit(b)
+		if err != nil {
+			return "", err
+		}
+		b = commit.Parent
+	}
+	return b, nil
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RemoveFromStage removes a file from the staging area so that its deletion is
+// committed. Unless cached is set the file is also deleted from the working
+// directory, which is refused for files whose content is not in HEAD unless
+// force is set. Directories are only removed when recursive is set. filePath
+// may be absolute or relative to the current directory.
+func (r *Repo) RemoveFromStage(filePath string, cached, recursive, force bool) ([]string, error) {
+	relPath, err := r.RelPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkNoInterruptedCheckout(); err != nil {
+		return nil, err
+	}
+	lock, err := r.lockIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer lock.rollback()
+	index, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	var removed []string
+	var removedEntries []IndexEntry
+	newIndex := &Index{}
+	for _, entry := range *index {
+		switch {
+		case entry.Path == relPath:
+			removed = append(removed, entry.Path)
+			removedEntries = append(removedEntries, entry)
+		case relPath == "." || strings.HasPrefix(entry.Path, relPath+"/"):
+			if !recursive {
+				return nil, fmt.Errorf("not removing '%s' recursively without -r", relPath)
+			}
+			removed = append(removed, entry.Path)
+			removedEntries = append(removedEntries, entry)
+		default:
+			*newIndex = append(*newIndex, entry)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, fmt.Errorf("pathspec '%s' did not match any tracked files", relPath)
+	}
+
+	if !cached && !force {
+		if err := r.checkRemovable(removedEntries); err != nil {
+			return nil, err
+		}
+	}
+	// Save the index first so a failed write cannot lose files that are
+	// still staged
+	if err := r.writeIndex(lock, newIndex); err != nil {
+		return nil, fmt.Errorf("failed to save index: %v", err)
+	}
+	if !cached {
+		for _, path := range removed {
+			err := os.Remove(r.workPath(path))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove file: %v", err)
+			}
+			r.removeEmptyParents(path)
+		}
+	}
+	return removed, nil
+}
+
+// Helper: Fail if deleting the work tree files of entries would lose
+// changes, because a file differs from its index entry or the entry from HEAD
+func (r *Repo) checkRemovable(entries []IndexEntry) error {
+	headTreeHash, err := r.GetHeadTree()
+	if err != nil {
+		return fmt.Errorf("failed to get head tree: %v", err)
+	}
+	headFiles := map[string]TreeEntry{}
+	if headTreeHash != "" {
+		if headFiles, err = r.GetTreeEntries(headTreeHash); err != nil {
+			return fmt.Errorf("failed to get tree files: %v", err)
+		}
+	}
+	attrs, err := r.loadAttributes()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		headEntry, inHead := headFiles[entry.Path]
+		modified := !inHead || headEntry.Hash != entry.BlobHash || headEntry.Mode != entry.Type
+		path := r.workPath(entry.Path)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !modified {
+			var hash string
+			mode := r.workFileMode(info, entry.Type)
+			if mode == modeSymlink {
+				hash, err = r.hashSymlink(path)
+			} else {
+				hash, err = r.hashWorkFile(path, entry.Path, attrs)
+			}
+			if err != nil {
+				return err
+			}
+			modified = hash != entry.BlobHash || mode != entry.Type
+		}
+		if modified {
+			return fmt.Errorf("'%s' has local modifications, use --cached to keep the file or -f to force removal", entry.Path)
+		}
+	}
+	return nil
+}
+
+// Helper: Remove the now empty parent directories of a repo-relative path
+func (r *Repo) removeEmptyParents(path string) {
+	dir := filepath.Dir(r.workPath(path))
+	for dir != r.WorkTree && strings.HasPrefix(dir, r.WorkTree) {
+		// os.Remove fails on non-empty directories, which ends the walk
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
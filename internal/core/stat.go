@@ -0,0 +1,46 @@
+package core
+
+import (
+	"os"
+	"time"
+)
+
+// FileStat is the file system metadata cached in an index entry. When a
+// file's current stat data still matches, its content is assumed unchanged
+// and it is not hashed again.
+type FileStat struct {
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"` // Nanoseconds since the epoch
+	CTime int64  `json:"ctime"` // Nanoseconds since the epoch, 0 where unavailable
+	Inode uint64 `json:"inode"` // 0 where unavailable
+	Mode  uint32 `json:"mode"`
+}
+
+// Filesystems may only record timestamps to the second, so files modified
+// within this window of an index write cannot be told apart from the write.
+const racyWindow = time.Second
+
+// fileStatOf returns the cached form of info.
+func fileStatOf(info os.FileInfo) FileStat {
+	ctime, inode := sysStat(info)
+	return FileStat{
+		Size:  info.Size(),
+		MTime: info.ModTime().UnixNano(),
+		CTime: ctime,
+		Inode: inode,
+		Mode:  uint32(info.Mode()),
+	}
+}
+
+// IsZero reports whether no stat data is cached.
+func (s FileStat) IsZero() bool {
+	return s == FileStat{}
+}
+
+// Helper: Reports whether the cached stat data of an entry can be trusted for
+// a file now described by current. As in git, an entry whose file was
+// modified no earlier than the index was written is "racily clean": the file
+// may have changed again within the same timestamp, so it must be rehashed.
+func statUnchanged(cached, current FileStat, indexMTime time.Time) bool {
+	return !cached.IsZero() && cached == current && cached.MTime < indexMTime.UnixNano()
+}
@@ -0,0 +1,15 @@
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// Helper: Change time and inode number from the platform stat data
+func sysStat(info os.FileInfo) (int64, uint64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return st.Ctim.Nano(), st.Ino
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package core
+
+import "os"
+
+// Helper: Change time and inode number are not cached on this platform
+func sysStat(info os.FileInfo) (int64, uint64) {
+	return 0, 0
+}
@@ -2,71 +2,236 @@ package core
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ChangeType is a single-letter status code, as used by git status --short.
+type ChangeType byte
 
-	"github.com/fatih/color"
+const (
+	Unmodified ChangeType = '.'
+	Added      ChangeType = 'A'
+	Modified   ChangeType = 'M'
+	Deleted    ChangeType = 'D'
+	Untracked  ChangeType = '?'
 )
 
-func Status() error {
-	index, err := LoadIndex()
+func (c ChangeType) String() string {
+	switch c {
+	case Added:
+		return "added"
+	case Modified:
+		return "modified"
+	case Deleted:
+		return "deleted"
+	case Untracked:
+		return "untracked"
+	}
+	return "unmodified"
+}
+
+// StatusEntry is the state of one path in HEAD, the index and the working directory.
+type StatusEntry struct {
+	Path      string
+	Staged    ChangeType // HEAD compared to the index
+	Unstaged  ChangeType // Index compared to the working directory
+	HeadMode  string     // Empty if the path is not in HEAD
+	HeadHash  string
+	IndexMode string // Empty if the path is not in the index
+	IndexHash string
+
+	WorktreeMode string // Empty if the path is not in the working directory
+}
+
+// StatusReport summarizes the state of the index and working directory.
+type StatusReport struct {
+	Branch   string // Current branch name, empty when HEAD is detached
+	Head     string // Current commit hash, empty before the first commit
+	Upstream string // Upstream ref such as "origin/main", empty if there is none
+	Ahead    int    // Commits on Branch that are not on Upstream
+	Behind   int    // Commits on Upstream that are not on Branch
+	Entries  []StatusEntry
+}
+
+// Status compares HEAD, the index and the working directory.
+func (r *Repo) Status() (*StatusReport, error) {
+	index, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	wdMap, err := r.ScanWorkingDir()
 	if err != nil {
-		return fmt.Errorf("failed to load index: %v", err)
+		return nil, fmt.Errorf("failed to scan working directory: %v", err)
 	}
 
-	wdMap, err := ScanWorkingDir()
+	stagedChanges, err := index.CompareToHead(r)
 	if err != nil {
-		return fmt.Errorf("failed to scan working directory: %v", err)
+		return nil, fmt.Errorf("failed to compare index to HEAD: %v", err)
+	}
+
+	entries := make(map[string]*StatusEntry)
+	entryFor := func(path string) *StatusEntry {
+		if entry, ok := entries[path]; ok {
+			return entry
+		}
+		entry := &StatusEntry{Path: path, Staged: Unmodified, Unstaged: Unmodified}
+		entries[path] = entry
+		return entry
 	}
 
-	var modifiedFiles, deletedFiles, untrackedFiles []string
+	for _, change := range stagedChanges {
+		entry := entryFor(change.Path)
+		entry.Staged = change.Change
+		entry.HeadMode, entry.HeadHash = change.HeadMode, change.HeadHash
+		entry.IndexMode, entry.IndexHash = change.IndexMode, change.IndexHash
+	}
 
-	for _, entry := range *index {
-		currentHash, exists := wdMap[entry.Path]
+	tracked := make(map[string]bool, len(*index))
+	for _, indexEntry := range *index {
+		tracked[indexEntry.Path] = true
+		current, exists := wdMap[indexEntry.Path]
+		var unstaged ChangeType
 		if !exists {
-			deletedFiles = append(deletedFiles, entry.Path)
+			unstaged = Deleted
+		} else if current.Hash != indexEntry.BlobHash || current.Mode != indexEntry.Type {
+			// If the blob hash or mode in working directory differs from index, mark as modified
+			unstaged = Modified
+		} else {
 			continue
 		}
-		// If the blob hash in working directory differs from index, mark as modified
-		if currentHash != entry.BlobHash {
-			modifiedFiles = append(modifiedFiles, entry.Path)
+		entry := entryFor(indexEntry.Path)
+		entry.Unstaged = unstaged
+		entry.IndexMode, entry.IndexHash = indexEntry.Type, indexEntry.BlobHash
+		if entry.Staged == Unmodified {
+			entry.HeadMode, entry.HeadHash = indexEntry.Type, indexEntry.BlobHash
 		}
 	}
 
+	report := &StatusReport{}
+	for _, entry := range entries {
+		entry.WorktreeMode = wdMap[entry.Path].Mode
+		report.Entries = append(report.Entries, *entry)
+	}
+
+	// Untracked files get their own entries, since a path deleted from the
+	// index with rm --cached is both staged for deletion and untracked.
 	for path := range wdMap {
-		_, exists := index.GetEntry(path)
-		if !exists {
-			untrackedFiles = append(untrackedFiles, path)
+		if !tracked[path] {
+			report.Entries = append(report.Entries, StatusEntry{Path: path, Staged: Untracked, Unstaged: Untracked})
+		}
+	}
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		a, b := report.Entries[i], report.Entries[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
 		}
+		return b.Staged == Untracked && a.Staged != Untracked
+	})
+
+	report.Branch, err = r.CurrentBranch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %v", err)
 	}
-	stagedChanges, err := index.CompareToHead()
+	report.Head, err = r.getCurrentCommit()
 	if err != nil {
-		return fmt.Errorf("failed to compare index to HEAD: %v", err)
+		return nil, fmt.Errorf("failed to read HEAD: %v", err)
 	}
+	if err := r.fillUpstream(report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
 
-	green := color.New(color.FgHiGreen).SprintFunc()
-	if len(stagedChanges) > 0 {
-		fmt.Println("\nChanges to be committed:")
-		for _, change := range stagedChanges {
-			fmt.Printf("\t%s\n", green(change))
+// StagedPaths returns the paths with the given change between HEAD and the index.
+func (s *StatusReport) StagedPaths(change ChangeType) []string {
+	var paths []string
+	for _, entry := range s.Entries {
+		if entry.Staged == change && change != Untracked {
+			paths = append(paths, entry.Path)
 		}
 	}
+	return paths
+}
 
-	red := color.New(color.FgHiRed).SprintFunc()
-	if len(modifiedFiles) > 0 || len(deletedFiles) > 0 {
-		fmt.Println("\nChanges not staged for commit:")
-		for _, path := range modifiedFiles {
-			fmt.Printf("\t%s: %s\n", red("modified"), red(path))
-		}
-		for _, path := range deletedFiles {
-			fmt.Printf("\t%s: %s\n", red("deleted"), red(path))
+// UnstagedPaths returns the paths with the given change between the index and
+// the working directory.
+func (s *StatusReport) UnstagedPaths(change ChangeType) []string {
+	var paths []string
+	for _, entry := range s.Entries {
+		if entry.Unstaged == change && change != Untracked {
+			paths = append(paths, entry.Path)
 		}
 	}
+	return paths
+}
 
-	if len(untrackedFiles) > 0 {
-		fmt.Println("\nUntracked files:")
-		for _, path := range untrackedFiles {
-			fmt.Printf("\t%s: %s\n", red("untracked"), red(path))
+// UntrackedPaths returns the paths in the working directory that are not in the index.
+func (s *StatusReport) UntrackedPaths() []string {
+	var paths []string
+	for _, entry := range s.Entries {
+		if entry.Staged == Untracked {
+			paths = append(paths, entry.Path)
 		}
 	}
+	return paths
+}
+
+// IsClean reports whether there are no staged, unstaged or untracked changes.
+func (s *StatusReport) IsClean() bool {
+	return len(s.Entries) == 0
+}
+
+// Helper: Set the upstream and ahead/behind counts when the current branch
+// has a matching remote-tracking ref under refs/remotes/origin.
+func (r *Repo) fillUpstream(report *StatusReport) error {
+	if report.Branch == "" {
+		return nil
+	}
+	upstream := "origin/" + report.Branch
+	data, err := os.ReadFile(r.gvcPath("refs", "remotes", "origin", report.Branch))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	report.Upstream = upstream
+	upstreamHash := strings.TrimSpace(string(data))
 
+	local, err := r.ancestors(report.Head)
+	if err != nil {
+		return err
+	}
+	remote, err := r.ancestors(upstreamHash)
+	if err != nil {
+		return err
+	}
+	for hash := range local {
+		if !remote[hash] {
+			report.Ahead++
+		}
+	}
+	for hash := range remote {
+		if !local[hash] {
+			report.Behind++
+		}
+	}
 	return nil
 }
+
+// Helper: Set of commits reachable from hash, including hash itself
+func (r *Repo) ancestors(hash string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	for hash != "" && !seen[hash] {
+		seen[hash] = true
+		commit, err := r.GetCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		hash = commit.Parent
+	}
+	return seen, nil
+}
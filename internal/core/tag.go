@@ -0,0 +1,338 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tag is a ref under refs/tags. A lightweight tag points straight at a
+// commit; an annotated tag points at a tag object naming the tagged object,
+// with a tagger, date and message.
+type Tag struct {
+	Name    string // Name without "refs/tags/"
+	Hash    string // What the ref points to: the tag object, or the commit of a lightweight tag
+	Object  string // The tagged object
+	Type    string // Type of the tagged object, "commit" for tags created by gvc
+	Tagger  string // Empty for lightweight tags
+	Date    time.Time
+	Message string
+}
+
+// Annotated reports whether the tag points to a tag object.
+func (t *Tag) Annotated() bool {
+	return t.Hash != t.Object
+}
+
+// CreateTag points refs/tags/<name> at the commit target resolves to (HEAD
+// if empty). With a message it creates an annotated tag object, else a
+// lightweight tag. An existing tag is only replaced with force.
+func (r *Repo) CreateTag(name, target, message, tagger string, force bool) (*Tag, error) {
+	if err := checkRefName(name); err != nil {
+		return nil, err
+	}
+	if target == "" {
+		target = "HEAD"
+	}
+	commitHash, err := r.ResolveCommit(target)
+	if err != nil {
+		return nil, err
+	}
+	// Checked before the tag object is written, which would be left behind
+	refPath := "refs/tags/" + name
+	old, err := os.ReadFile(r.gvcPath(refPath))
+	if err == nil && !force {
+		return nil, fmt.Errorf("tag '%s' already exists", name)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	tag := &Tag{Name: name, Hash: commitHash, Object: commitHash, Type: "commit"}
+	if message != "" {
+		tag.Tagger, tag.Date, tag.Message = tagger, time.Now(), message
+		content := fmt.Sprintf(
+			"object %s\n"+
+				"type %s\n"+
+				"tag %s\n"+
+				"tagger %s %d +0000\n\n"+
+				"%s\n",
+			tag.Object, tag.Type, tag.Name, tag.Tagger, tag.Date.Unix(), tag.Message,
+		)
+		if tag.Hash, err = r.CreateObject("tag", []byte(content)); err != nil {
+			return nil, fmt.Errorf("create tag object: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(r.gvcPath(refPath)), 0755); err != nil {
+		return nil, err
+	}
+	if err := r.updateRef(refPath, tag.Hash, strings.TrimSpace(string(old))); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// DeleteTag removes refs/tags/<name> and returns the hash it pointed to. The
+// tag object of an annotated tag is left for prune.
+func (r *Repo) DeleteTag(name string) (string, error) {
+	if err := checkRefName(name); err != nil {
+		return "", err
+	}
+	refPath := r.gvcPath("refs", "tags", filepath.FromSlash(name))
+	lock, err := acquireLock(refPath)
+	if err != nil {
+		return "", err
+	}
+	old, err := os.ReadFile(refPath)
+	if err == nil {
+		err = os.Remove(refPath)
+	}
+	// Released before the directory holding the lock file can be dropped
+	lock.rollback()
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("tag '%s' not found", name)
+	} else if err != nil {
+		return "", err
+	}
+	// Drop directories left empty by hierarchical names like "release/v1"
+	tagsDir := r.gvcPath("refs", "tags")
+	for dir := filepath.Dir(refPath); dir != tagsDir; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return strings.TrimSpace(string(old)), nil
+}
+
+// ListTags returns the tags whose names match one of patterns (all tags
+// without patterns), sorted by sortKey: "refname" (the default) or
+// "version:refname", where runs of digits compare by value so v1.10 comes
+// after v1.9. A leading "-" reverses the order.
+func (r *Repo) ListTags(patterns []string, sortKey string) ([]Tag, error) {
+	reverse := strings.HasPrefix(sortKey, "-")
+	var byVersion bool
+	switch strings.TrimPrefix(sortKey, "-") {
+	case "", "refname":
+	case "version:refname", "v:refname":
+		byVersion = true
+	default:
+		return nil, fmt.Errorf("unsupported sort key '%s'", sortKey)
+	}
+
+	refs, err := r.ListRefs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %v", err)
+	}
+	var tags []Tag
+	for ref, hash := range refs {
+		name, found := strings.CutPrefix(ref, "refs/tags/")
+		if !found || !matchesTagPattern(patterns, name) {
+			continue
+		}
+		tag, err := r.readTag(name, hash)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, *tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		a, b := tags[i].Name, tags[j].Name
+		if reverse {
+			a, b = b, a
+		}
+		if byVersion {
+			return compareVersions(a, b) < 0
+		}
+		return a < b
+	})
+	return tags, nil
+}
+
+// Helper: Reports whether name matches one of patterns, or there are none
+func matchesTagPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return len(patterns) == 0
+}
+
+// Helper: The tag refs/tags/<name> pointing at hash
+func (r *Repo) readTag(name, hash string) (*Tag, error) {
+	typ, err := r.objectType(hash)
+	if err != nil {
+		return nil, fmt.Errorf("tag '%s': %v", name, err)
+	}
+	if typ != "tag" {
+		return &Tag{Name: name, Hash: hash, Object: hash, Type: typ}, nil
+	}
+	tag, err := r.GetTag(hash)
+	if err != nil {
+		return nil, err
+	}
+	tag.Name = name
+	return tag, nil
+}
+
+// GetTag reads a tag object. Name is the name recorded in the object, which
+// may differ from the ref pointing to it.
+func (r *Repo) GetTag(hash string) (*Tag, error) {
+	data, err := r.GetObjectContent(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag %s: %v", hash, err)
+	}
+	typ, content, err := splitObject(data)
+	if err != nil || typ != "tag" {
+		return nil, fmt.Errorf("invalid tag object: %s", hash)
+	}
+	return parseTag(hash, content)
+}
+
+// Helper: Parse tag object content into a Tag
+func parseTag(hash string, content []byte) (*Tag, error) {
+	lines := strings.Split(string(content), "\n")
+	tag := &Tag{Hash: hash}
+	for i, line := range lines {
+		if rest, found := strings.CutPrefix(line, "object "); found {
+			tag.Object = rest
+		} else if rest, found := strings.CutPrefix(line, "type "); found {
+			tag.Type = rest
+		} else if rest, found := strings.CutPrefix(line, "tag "); found {
+			tag.Name = rest
+		} else if strings.HasPrefix(line, "tagger ") {
+			// Example: "tagger alice 1700000000 +0000"
+			fields := strings.Split(line, " ")
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("invalid tagger details: %s", hash)
+			}
+			tag.Tagger = strings.Join(fields[1:len(fields)-2], " ")
+			timestamp, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tagger timestamp: %s", hash)
+			}
+			tag.Date = time.Unix(timestamp, 0)
+		} else if line == "" {
+			tag.Message = strings.TrimSuffix(strings.Join(lines[i+1:], "\n"), "\n")
+			break
+		}
+	}
+	if tag.Object == "" || tag.Type == "" || tag.Name == "" {
+		return nil, fmt.Errorf("invalid tag object, missing object, type or tag: %s", hash)
+	}
+	return tag, nil
+}
+
+// Helper: Follow tag objects from hash to the object they end at, returning
+// it with its type. The tag objects passed are added to objects if not nil.
+func (r *Repo) peelTags(hash string, objects map[string]reachableObject) (string, string, error) {
+	for depth := 0; ; depth++ {
+		typ, err := r.objectType(hash)
+		if err != nil {
+			return "", "", err
+		}
+		if typ != "tag" {
+			return hash, typ, nil
+		}
+		if depth == 100 {
+			return "", "", fmt.Errorf("tag %s: too many nested tags", hash)
+		}
+		if objects != nil {
+			objects[hash] = reachableObject{Type: "tag"}
+		}
+		tag, err := r.GetTag(hash)
+		if err != nil {
+			return "", "", err
+		}
+		hash = tag.Object
+	}
+}
+
+// Helper: The type of an object, without reading its content
+func (r *Repo) objectType(hash string) (string, error) {
+	typ, _, rc, err := r.OpenObject(hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to read object %s: %v", hash, err)
+	}
+	rc.Close()
+	return typ, nil
+}
+
+// Helper: Check a branch or tag name the way git check-ref-format does, so
+// names stay usable as paths under .gvc/refs
+func checkRefName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("'%s' is not a valid ref name: %s", name, reason)
+	}
+	if name == "" {
+		return invalid("empty")
+	}
+	if strings.HasPrefix(name, "-") {
+		return invalid("starts with '-'")
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.Contains(name, "//") {
+		return invalid("contains '..', '@{' or '//'")
+	}
+	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") {
+		return invalid("starts or ends with '/', or ends with '.'")
+	}
+	if strings.ContainsAny(name, " ~^:?*[\\") {
+		return invalid("contains one of ' ~^:?*[\\'")
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, lockSuffix) {
+			return invalid("a component starts with '.' or ends with '.lock'")
+		}
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f {
+			return invalid("contains a control character")
+		}
+	}
+	return nil
+}
+
+// Helper: Compare names with runs of digits compared by value, so that
+// "v1.9" < "v1.10"
+func compareVersions(a, b string) int {
+	x, y := a, b
+	for x != "" && y != "" {
+		if isDigit(x[0]) && isDigit(y[0]) {
+			i, j := digitRun(x), digitRun(y)
+			nx, ny := strings.TrimLeft(x[:i], "0"), strings.TrimLeft(y[:j], "0")
+			if len(nx) != len(ny) {
+				return len(nx) - len(ny)
+			}
+			if c := strings.Compare(nx, ny); c != 0 {
+				return c
+			}
+			x, y = x[i:], y[j:]
+			continue
+		}
+		if x[0] != y[0] {
+			return int(x[0]) - int(y[0])
+		}
+		x, y = x[1:], y[1:]
+	}
+	if len(x) != len(y) {
+		return len(x) - len(y)
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// Helper: Length of the run of digits at the start of s
+func digitRun(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
@@ -3,8 +3,7 @@ package core
 import (
 	"bytes"
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
 	"sort"
 	"strings"
 )
@@ -12,16 +11,16 @@ import (
 // TreeEntry represents an entry in a tree object.
 type TreeEntry struct {
 	Mode string // e.g., "100644" for files
-	Type string // "blob" or "tree"
+	Type string // "blob", "chunks" or "tree"
 	Hash string // SHA-1 hash of the blob/tree
 	Path string // File or directory name
 }
 
-// CreateTreeFromIndex generates a tree object from the staging area (index.json).
-func CreateTreeFromIndex() (string, error) {
-	index, err := LoadIndex()
+// CreateTreeFromIndex generates a tree object from the staging area.
+func (r *Repo) CreateTreeFromIndex() (string, error) {
+	index, err := r.LoadIndex()
 	if err != nil {
-		return "", fmt.Errorf("failed to load index: %v", err)
+		return "", fmt.Errorf("failed to load index: %w", err)
 	}
 
 	// Sort entries for consistent hashing
@@ -29,7 +28,7 @@ func CreateTreeFromIndex() (string, error) {
 		return (*index)[i].Path < (*index)[j].Path
 	})
 
-	trees, err := createTreeRecursive("", index)
+	trees, err := r.createTreeRecursive("", index)
 	if err != nil {
 		return "", fmt.Errorf("failed to create tree: %v", err)
 	}
@@ -38,7 +37,7 @@ func CreateTreeFromIndex() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	hash, err := CreateObject("tree", treeByte)
+	hash, err := r.CreateObject("tree", treeByte)
 	if err != nil {
 		return "", err
 	}
@@ -46,22 +45,25 @@ func CreateTreeFromIndex() (string, error) {
 	return hash, nil
 }
 
-// GetHeadTree returns the hash of the tree object pointed by HEAD commit.
-func GetHeadTree() (string, error) {
-	commitHash, err := getCurrentCommit()
+// GetHeadTree returns the hash of the tree object pointed by HEAD commit, or
+// an empty string if there are no commits yet.
+func (r *Repo) GetHeadTree() (string, error) {
+	commitHash, err := r.getCurrentCommit()
 	if err != nil {
 		return "", err
 	}
-	commit, err := GetCommit(commitHash)
+	if commitHash == "" {
+		return "", nil
+	}
+	commit, err := r.GetCommit(commitHash)
 	if err != nil {
 		return "", err
 	}
 	return commit.Tree, nil
 }
 
-func GetTree(hash string) ([]TreeEntry, error) {
-	objectPath := filepath.Join(".gvc", "objects", hash[:2], hash[2:])
-	data, err := os.ReadFile(objectPath)
+func (r *Repo) GetTree(hash string) ([]TreeEntry, error) {
+	data, err := r.GetObjectContent(hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read tree %s: %v", hash, err)
 	}
@@ -72,8 +74,12 @@ func GetTree(hash string) ([]TreeEntry, error) {
 		return nil, fmt.Errorf("invalid tree object: %s", hash)
 	}
 
-	content := string(parts[1])
-	lines := strings.Split(content, "\n")
+	return parseTree(hash, parts[1])
+}
+
+// Helper: Parse tree content, one "mode type hash\tname" line per entry
+func parseTree(hash string, content []byte) ([]TreeEntry, error) {
+	lines := strings.Split(string(content), "\n")
 
 	tree := []TreeEntry{}
 	for _, line := range lines {
@@ -82,6 +88,9 @@ func GetTree(hash string) ([]TreeEntry, error) {
 		}
 		parts := strings.SplitN(line, "\t", 2)
 		meta := strings.Split(parts[0], " ")
+		if len(parts) != 2 || len(meta) != 3 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid tree object %s: malformed entry %q", hash, line)
+		}
 		tree = append(tree, TreeEntry{
 			Mode: meta[0],
 			Type: meta[1],
@@ -93,7 +102,7 @@ func GetTree(hash string) ([]TreeEntry, error) {
 	return tree, nil
 }
 
-func createTreeRecursive(parent string, index *Index) ([]TreeEntry, error) {
+func (r *Repo) createTreeRecursive(parent string, index *Index) ([]TreeEntry, error) {
 	var tree []TreeEntry
 
 	// Create a set to store children
@@ -120,14 +129,14 @@ func createTreeRecursive(parent string, index *Index) ([]TreeEntry, error) {
 			}
 		}
 
-		// Skip if the entry is not a child of the parent
+		// Skip if the entry is not below the parent
+		if len(parents) != 0 {
+			continue
+		}
 		if len(paths) == 1 {
-			if len(parents) != 0 {
-				continue
-			}
 			tree = append(tree, TreeEntry{
 				Mode: entry.Type,
-				Type: "blob",
+				Type: entry.ObjectType(),
 				Hash: entry.BlobHash,
 				Path: paths[0],
 			})
@@ -142,9 +151,9 @@ func createTreeRecursive(parent string, index *Index) ([]TreeEntry, error) {
 		var childTrees []TreeEntry
 		var err error
 		if parent == "" {
-			childTrees, err = createTreeRecursive(child, index)
+			childTrees, err = r.createTreeRecursive(child, index)
 		} else {
-			childTrees, err = createTreeRecursive(parent+"/"+child, index)
+			childTrees, err = r.createTreeRecursive(parent+"/"+child, index)
 		}
 		if err != nil {
 			return nil, err
@@ -153,7 +162,7 @@ func createTreeRecursive(parent string, index *Index) ([]TreeEntry, error) {
 		if err != nil {
 			return nil, err
 		}
-		hash, err := CreateObject("tree", treeByte)
+		hash, err := r.CreateObject("tree", treeByte)
 		if err != nil {
 			return nil, err
 		}
@@ -164,6 +173,11 @@ func createTreeRecursive(parent string, index *Index) ([]TreeEntry, error) {
 			Path: child,
 		})
 	}
+	// Map order varies between runs, so the same index always hashes to the
+	// same tree only with the entries sorted
+	sort.Slice(tree, func(i, j int) bool {
+		return tree[i].Path < tree[j].Path
+	})
 	return tree, nil
 }
 
@@ -177,28 +191,43 @@ func ConvertTreeToByte(tree []TreeEntry) ([]byte, error) {
 	return treeContent.Bytes(), nil
 }
 
-// GetTree returns a map of file paths to their blob hash in a tree object.
-func GetTreeFiles(hash string) (map[string]string, error) {
-	tree, err := GetTree(hash)
+// GetTreeFiles returns a map of file paths to their blob hash in a tree object.
+func (r *Repo) GetTreeFiles(hash string) (map[string]string, error) {
+	entries, err := r.GetTreeEntries(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string, len(entries))
+	for filePath, entry := range entries {
+		files[filePath] = entry.Hash
+	}
+	return files, nil
+}
+
+// GetTreeEntries returns a map of file paths to their blob entries in a tree
+// object, descending into subtrees. Each entry's Path is the full path.
+func (r *Repo) GetTreeEntries(hash string) (map[string]TreeEntry, error) {
+	tree, err := r.GetTree(hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tree: %v", err)
 	}
 
-	files := make(map[string]string)
+	files := make(map[string]TreeEntry)
 	for _, entry := range tree {
 		switch entry.Type {
-		case "blob":
-			files[entry.Path] = entry.Hash
+		case "blob", "chunks":
+			files[entry.Path] = entry
 		case "tree":
 			// Recursively get files from the subtree.
-			subFiles, err := GetTreeFiles(entry.Hash)
+			subFiles, err := r.GetTreeEntries(entry.Hash)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get tree for %s: %v", entry.Path, err)
 			}
 			// Prepend the directory name to each file path from the sub-tree.
-			for subPath, subHash := range subFiles {
-				fullPath := filepath.Join(entry.Path, subPath)
-				files[fullPath] = subHash
+			for subPath, subEntry := range subFiles {
+				subEntry.Path = path.Join(entry.Path, subPath)
+				files[subEntry.Path] = subEntry
 			}
 		}
 	}
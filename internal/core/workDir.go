@@ -1,115 +1,513 @@
 package core
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// ScanWorkingDir scans the working directory and returns a map of file paths to their blob hash.
-func ScanWorkingDir() (map[string]string, error) {
-	m := make(map[string]string)
-	// Walk through the working directory
-	err := filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+// File modes recorded in the index and in trees
+const (
+	modeFile       = "100644"
+	modeExecutable = "100755"
+	modeSymlink    = "120000"
+)
+
+// WorkFile is a file in the working directory as add would stage it.
+type WorkFile struct {
+	Hash string // Hash of the blob (or chunks object)
+	Mode string // "100644", "100755" for executable files or "120000" for symlinks
+}
+
+// errScanFailed stops the walk of ScanWorkingDir once a worker has failed.
+var errScanFailed = errors.New("scan failed")
+
+// hashJob is a work tree file ScanWorkingDir has to read.
+type hashJob struct {
+	path    string
+	relPath string
+	mode    string
+	stat    FileStat
+	entry   *IndexEntry // Nil for untracked files
+	hash    string      // Set by a worker
+	err     error
+}
+
+// ScanWorkingDir scans the working directory and returns a map of file paths
+// (relative to the repository root) to their hash and mode. Tracked files
+// whose stat data matches the index are not read; files that had to be hashed
+// but turned out unchanged get their cached stat data refreshed. Files are
+// hashed by core.workers goroutines while the walk goes on.
+//
+// With core.fsmonitor enabled, only the paths the file system monitor reports
+// as changed since the previous scan are looked at; the walk of the whole
+// tree is the fallback whenever the monitor cannot answer.
+func (r *Repo) ScanWorkingDir() (map[string]WorkFile, error) {
+	s, err := r.newWorkScan()
+	if err != nil {
+		return nil, err
+	}
+	token, previous, dirty, incremental := r.fsmonitorChanges()
+	if incremental {
+		err = s.update(previous, dirty)
+	} else {
+		err = s.walk(r.WorkTree)
+	}
+	m, err := s.finish(err)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		r.saveFSMonitorState(token, m)
+	}
+	return m, nil
+}
+
+// workScan collects the files of the working directory for ScanWorkingDir.
+// Workers hash the files the walk sends them. The results are collected in
+// walk order by finish, so the outcome, including which error is reported,
+// does not depend on scheduling.
+type workScan struct {
+	repo        *Repo
+	m           map[string]WorkFile
+	attrs       *pathAttributes
+	indexMTime  time.Time
+	tracked     map[string]*IndexEntry
+	trackedDirs map[string]bool
+	ignore      *ignoreMatcher
+
+	jobs   []*hashJob
+	queue  chan *hashJob
+	failed atomic.Bool
+	wg     sync.WaitGroup
+}
+
+// Helper: Load what a scan needs and start its workers
+func (r *Repo) newWorkScan() (*workScan, error) {
+	attrs, err := r.loadAttributes()
+	if err != nil {
+		return nil, err
+	}
+	index, err := r.LoadIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	ignore, err := r.newIgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+	s := &workScan{
+		repo:        r,
+		m:           make(map[string]WorkFile),
+		attrs:       attrs,
+		indexMTime:  r.indexModTime(),
+		tracked:     make(map[string]*IndexEntry, len(*index)),
+		trackedDirs: trackedPaths(index),
+		ignore:      ignore,
+		queue:       make(chan *hashJob, 64),
+	}
+	for i := range *index {
+		s.tracked[(*index)[i].Path] = &(*index)[i]
+	}
+	for i := 0; i < r.workers(); i++ {
+		s.wg.Add(1)
+		go s.hashFiles()
+	}
+	return s, nil
+}
+
+// Helper: Worker hashing the files sent on the queue
+func (s *workScan) hashFiles() {
+	defer s.wg.Done()
+	for job := range s.queue {
+		if s.failed.Load() {
+			continue // Drain the queue once the scan is failing
+		}
+		if job.mode == modeSymlink {
+			job.hash, job.err = s.repo.hashSymlink(job.path)
+		} else {
+			job.hash, job.err = s.repo.hashWorkFile(job.path, job.relPath, s.attrs)
+		}
+		if job.err != nil {
+			s.failed.Store(true)
+		}
+	}
+}
+
+// Helper: Add the files below root, or root itself if it is a file
+func (s *workScan) walk(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 		// ignore all directories which start with .
-		if d.IsDir() && len(d.Name()) > 1 && d.Name()[0] == '.' {
+		if d.IsDir() && path != s.repo.WorkTree && d.Name()[0] == '.' {
 			return filepath.SkipDir
 		}
+		if path == s.repo.WorkTree {
+			return nil
+		}
+		relPath, err := filepath.Rel(s.repo.WorkTree, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		// Untracked files and directories matching an ignore pattern are left out
+		if !s.trackedDirs[relPath] {
+			if match, err := s.ignore.ignored(relPath, d.IsDir()); err != nil {
+				return err
+			} else if match != nil && d.IsDir() {
+				return filepath.SkipDir
+			} else if match != nil {
+				return nil
+			}
+		}
+		if s.failed.Load() {
+			return errScanFailed
+		}
 		if !d.IsDir() {
-			// Read the file content
-			data, err := os.ReadFile(path)
+			info, err := d.Info()
 			if err != nil {
-				return fmt.Errorf("failed to read file: %v", err)
+				return fmt.Errorf("failed to stat file: %v", err)
 			}
-			hashStr, _ := GetObjectData("blob", data)
-			m[path] = hashStr
+			s.addFile(path, relPath, info)
 		}
 		return nil
 	})
-	if err != nil {
+}
+
+// Helper: Record a file, queueing it for hashing unless its stat data
+// matches the index
+func (s *workScan) addFile(path, relPath string, info os.FileInfo) {
+	stat := fileStatOf(info)
+	entry := s.tracked[relPath]
+	indexMode := ""
+	if entry != nil {
+		indexMode = entry.Type
+	}
+	mode := s.repo.workFileMode(info, indexMode)
+	if entry != nil && statUnchanged(entry.Stat, stat, s.indexMTime) {
+		s.m[relPath] = WorkFile{Hash: entry.BlobHash, Mode: mode}
+		return
+	}
+	job := &hashJob{path: path, relPath: relPath, mode: mode, stat: stat, entry: entry}
+	s.jobs = append(s.jobs, job)
+	s.queue <- job
+}
+
+// Helper: Bring the files of a previous scan up to date, looking only at the
+// dirty paths and everything below them, and at files whose tracking changed
+func (s *workScan) update(previous map[string]WorkFile, dirty []string) error {
+	isDirty := make(map[string]bool, len(dirty))
+	for _, relPath := range dirty {
+		isDirty[relPath] = true
+	}
+	underDirty := func(relPath string) bool {
+		for ; relPath != ""; relPath = parentDir(relPath) {
+			if isDirty[relPath] {
+				return true
+			}
+		}
+		return false
+	}
+	trustModes := true
+	if value, _ := s.repo.Config.Get("core.filemode"); value == "false" {
+		trustModes = false
+	}
+
+	for relPath, file := range previous {
+		if underDirty(relPath) {
+			continue
+		}
+		entry := s.tracked[relPath]
+		if entry == nil {
+			// A file removed from the index may be ignored now
+			if match, err := s.ignore.ignored(relPath, false); err != nil {
+				return err
+			} else if match != nil {
+				continue
+			}
+		}
+		if !trustModes && file.Mode != modeSymlink {
+			file.Mode = modeFile
+			if entry != nil {
+				file.Mode = entry.Type
+			}
+		}
+		s.m[relPath] = file
+	}
+
+	// Files staged since the previous scan were left out of it if ignored
+	var paths []string
+	for relPath := range s.tracked {
+		if _, found := previous[relPath]; !found && !underDirty(relPath) {
+			paths = append(paths, relPath)
+		}
+	}
+	for relPath := range isDirty {
+		if !underDirty(parentDir(relPath)) {
+			paths = append(paths, relPath)
+		}
+	}
+	sort.Strings(paths)
+	for _, relPath := range paths {
+		if hiddenDir(parentDir(relPath)) {
+			continue
+		}
+		path := s.repo.workPath(relPath)
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to stat file: %v", err)
+		}
+		if err := s.walk(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper: Reports whether a directory is or is inside one the scan skips
+func hiddenDir(relDir string) bool {
+	for ; relDir != ""; relDir = parentDir(relDir) {
+		if path.Base(relDir)[0] == '.' {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper: Wait for the workers and return the files, or the error of the
+// walk or of the first file that could not be read
+func (s *workScan) finish(err error) (map[string]WorkFile, error) {
+	close(s.queue)
+	s.wg.Wait()
+	if err != nil && err != errScanFailed {
 		return nil, fmt.Errorf("failed to walk through working directory: %v", err)
 	}
-	return m, nil
+
+	if s.failed.Load() {
+		for _, job := range s.jobs {
+			if job.err != nil {
+				return nil, fmt.Errorf("failed to read file: %v", job.err)
+			}
+		}
+	}
+	var unchanged []*hashJob
+	for _, job := range s.jobs {
+		s.m[job.relPath] = WorkFile{Hash: job.hash, Mode: job.mode}
+		if job.entry != nil && job.hash == job.entry.BlobHash && job.entry.Stat != job.stat {
+			unchanged = append(unchanged, job)
+		}
+	}
+	if len(unchanged) > 0 {
+		s.refreshIndex(unchanged)
+	}
+	return s.m, nil
 }
 
-func IsWorkingDirClean() (bool, error) {
-	index, err := LoadIndex()
+// Helper: Save the stat data of files that were hashed but turned out
+// unchanged. The index was loaded without its lock, so another command may
+// have written it since: it is reloaded under the lock and left alone if it
+// was rewritten, and only entries still staging what was hashed are
+// refreshed. Refreshing is only an optimization, so a held lock or a
+// read-only repository is no error.
+func (s *workScan) refreshIndex(jobs []*hashJob) {
+	lock, err := s.repo.lockIndex()
 	if err != nil {
-		return false, fmt.Errorf("failed to load index: %v", err)
+		return
+	}
+	defer lock.rollback()
+	if !s.repo.indexModTime().Equal(s.indexMTime) {
+		return
 	}
-	wdMap, err := ScanWorkingDir()
+	index, err := s.repo.LoadIndex()
+	if err != nil {
+		return
+	}
+	entries := make(map[string]*IndexEntry, len(*index))
+	for i := range *index {
+		entries[(*index)[i].Path] = &(*index)[i]
+	}
+	refreshed := false
+	for _, job := range jobs {
+		entry, ok := entries[job.relPath]
+		if ok && entry.BlobHash == job.entry.BlobHash && entry.Type == job.entry.Type && entry.Stat != job.stat {
+			entry.Stat = job.stat
+			refreshed = true
+		}
+	}
+	if refreshed {
+		s.repo.writeIndex(lock, index)
+	}
+}
+
+// Helper: Number of goroutines hashing files, core.workers or one per CPU
+func (r *Repo) workers() int {
+	if value, ok := r.Config.Get("core.workers"); ok {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return runtime.NumCPU()
+}
+
+func (r *Repo) IsWorkingDirClean() (bool, error) {
+	index, err := r.LoadIndex()
+	if err != nil {
+		return false, fmt.Errorf("failed to load index: %w", err)
+	}
+	wdMap, err := r.ScanWorkingDir()
 	if err != nil {
 		return false, fmt.Errorf("failed to scan working directory: %v", err)
 	}
 	for _, entry := range *index {
-		currentHash, exists := wdMap[entry.Path]
+		current, exists := wdMap[entry.Path]
 		// Check if the file in index doesn't exist in working directory
 		if !exists {
 			return false, nil
 		}
-		// If the blob hash in working directory differs from index, it's not clean
-		if currentHash != entry.BlobHash {
+		// If the blob hash or mode in working directory differs from index, it's not clean
+		if current.Hash != entry.BlobHash || current.Mode != entry.Type {
 			return false, nil
 		}
 	}
 	return true, nil
 }
 
-//  Matches the working directory with the commit and the index with the new HEAD.
-// TODO: Make this function a transaction to avoid partial updates
-func MatchDirectoryWithCommit(commitHash string) error {
-	commit, err := GetCommit(commitHash)
-	if err != nil {
-		return fmt.Errorf("failed to get commit: %v", err)
+// Helper: Mode add records for a work tree file. With core.filemode set to
+// false the executable bit is not trusted and indexMode, if any, is kept.
+func (r *Repo) workFileMode(info os.FileInfo, indexMode string) string {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return modeSymlink
 	}
-	treeFiles, err := GetTreeFiles(commit.Tree)
-	if err != nil {
-		return fmt.Errorf("failed to get tree files: %v", err)
+	if value, _ := r.Config.Get("core.filemode"); value == "false" {
+		if indexMode != "" {
+			return indexMode
+		}
+		return modeFile
 	}
-	wdMap, err := ScanWorkingDir()
-	if err != nil {
-		return fmt.Errorf("failed to scan working dir: %v", err)
+	if info.Mode().Perm()&0111 != 0 {
+		return modeExecutable
 	}
-	index, err := LoadIndex()
+	return modeFile
+}
+
+// Helper: Permissions of a file checked out with mode
+func permForMode(mode string) os.FileMode {
+	if mode == modeExecutable {
+		return 0755
+	}
+	return 0644
+}
+
+// Helper: Blob hash of the target of a symlink
+func (r *Repo) hashSymlink(path string) (string, error) {
+	target, err := os.Readlink(path)
 	if err != nil {
-		return fmt.Errorf("failed to load index: %v", err)
+		return "", err
 	}
-	for path := range wdMap {
-		// Skip untracked files
-		if _, exists := index.GetEntry(path); !exists {
-			continue
+	hashStr, _ := r.GetObjectData("blob", []byte(target))
+	return hashStr, nil
+}
+
+// Helper: Hash of a work tree file as add would store it: the LFS pointer
+// for LFS files, the chunks object for chunked files, else the blob
+func (r *Repo) hashWorkFile(path, relPath string, attrs *pathAttributes) (string, error) {
+	switch {
+	case matchesAnyPattern(attrs.lfs, relPath):
+		pointer, err := lfsPointerForFile(path)
+		if err != nil {
+			return "", err
 		}
-		if _, exists := treeFiles[path]; !exists {
-			// If the file in the working directory is not in the tree, delete it
-			err := os.Remove(path)
-			if err != nil {
-				return fmt.Errorf("failed to remove file: %v", err)
-			}
-			continue
+		hashStr, _ := r.GetObjectData("blob", pointer.Bytes())
+		return hashStr, nil
+	case matchesAnyPattern(attrs.chunked, relPath):
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
 		}
+		defer f.Close()
+		return r.chunkStream(f, false)
 	}
+	return r.HashFile(path)
+}
 
-	newIndex := &Index{}
-	// Matching tree to index
-	for path, hash := range treeFiles {
-		// TODO: check the type of file
-		// Adding entries to match the index with the commit
-		*newIndex = append(*newIndex, IndexEntry{
-			Path:     path,
-			BlobHash: hash,
-			Type: "100644",
-		})
-		// Modify the files in working dir to match the commit
-		data, err := ReadBlobData(hash)
+// Helper: Stream a blob into a work tree file with the given mode through a
+// temporary file, so the file is replaced whole. LFS pointers are replaced by
+// their content when it is in the LFS store; symlinks are created pointing to
+// the target stored in the blob.
+func (r *Repo) writeBlobToFile(hash, path, mode string) error {
+	if mode == modeSymlink {
+		return r.writeSymlink(hash, path)
+	}
+	blob, size, err := r.OpenBlob(hash)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	var src io.Reader = blob
+	if size <= lfsMaxPointerSize {
+		data, err := io.ReadAll(blob)
 		if err != nil {
-			return fmt.Errorf("failed to read blob data: %v", err)
+			return err
 		}
-		err = os.WriteFile(path, data, 0644)
-		if err != nil {
-			return fmt.Errorf("failed to write file: %v", err)
+		src = bytes.NewReader(data)
+		if pointer, ok := ParseLFSPointer(data); ok {
+			if content, err := os.Open(r.lfsObjectPath(pointer.OID)); err == nil {
+				defer content.Close()
+				src = content
+			}
 		}
 	}
-	
-	return newIndex.SaveIndex()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gvc-checkout-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), permForMode(mode)); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Helper: Replace path with a symlink to the target stored in a blob
+func (r *Repo) writeSymlink(hash, path string) error {
+	target, err := r.ReadBlobData(hash)
+	if err != nil {
+		return err
+	}
+	// Create the link under a temporary name, then rename it over path
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gvc-checkout-")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	if err := os.Symlink(string(target), tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+)
+
+// Benchmarks of status on synthetic trees, run with
+//
+//	go test ./internal/test -run '^$' -bench Status
+//
+// "clean" measures a committed tree whose stat data is cached in the index,
+// "untracked" a tree where every file has to be read and hashed.
+
+var benchmarkSizes = []int{100, 1000, 10000}
+
+func BenchmarkStatusClean(b *testing.B) {
+	for _, files := range benchmarkSizes {
+		b.Run(fmt.Sprintf("files=%d", files), func(b *testing.B) {
+			repo := syntheticRepo(b, files, 0)
+			if err := repo.Add("."); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := repo.Commit("synthetic tree", "bench"); err != nil {
+				b.Fatal(err)
+			}
+			benchmarkStatus(b, repo)
+		})
+	}
+}
+
+func BenchmarkStatusUntracked(b *testing.B) {
+	for _, files := range benchmarkSizes {
+		for _, workers := range []int{1, 0} {
+			name := fmt.Sprintf("files=%d/workers=%d", files, workers)
+			if workers == 0 {
+				name = fmt.Sprintf("files=%d/workers=default", files)
+			}
+			b.Run(name, func(b *testing.B) {
+				benchmarkStatus(b, syntheticRepo(b, files, workers))
+			})
+		}
+	}
+}
+
+func benchmarkStatus(b *testing.B, repo *gvc.Repository) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.Status(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// syntheticRepo creates a repository with files of 1-8 KiB spread over
+// directories of 100 files each. workers sets core.workers unless it is 0.
+func syntheticRepo(b *testing.B, files, workers int) *gvc.Repository {
+	b.Helper()
+	dir := b.TempDir()
+	if _, err := gvc.Init(dir); err != nil {
+		b.Fatal(err)
+	}
+	if workers > 0 {
+		f, err := os.OpenFile(filepath.Join(dir, ".gvc", "config"), os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			b.Fatal(err)
+		}
+		fmt.Fprintf(f, "\tworkers = %d\n", workers)
+		f.Close()
+	}
+
+	rng := rand.New(rand.NewSource(int64(files)))
+	content := make([]byte, 8<<10)
+	old := time.Now().Add(-time.Hour)
+	for i := 0; i < files; i++ {
+		rng.Read(content)
+		path := filepath.Join(dir, fmt.Sprintf("dir%03d", i/100), fmt.Sprintf("file%05d.dat", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, content[:1<<10+rng.Intn(7<<10)], 0644); err != nil {
+			b.Fatal(err)
+		}
+		// Old enough that the stat data is not racy once cached
+		if err := os.Chtimes(path, old, old); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	repo, err := gvc.Open(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return repo
+}
@@ -0,0 +1,221 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+)
+
+var (
+	buildOnce sync.Once
+	binDir    string
+	binPath   string
+	buildErr  error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if binDir != "" {
+		os.RemoveAll(binDir)
+	}
+	os.Exit(code)
+}
+
+// gvcBinary builds the gvc command once for all tests that run it.
+func gvcBinary(t *testing.T) string {
+	t.Helper()
+	buildOnce.Do(func() {
+		binDir, buildErr = os.MkdirTemp("", "gvc-bin")
+		if buildErr != nil {
+			return
+		}
+		binPath = filepath.Join(binDir, "gvc")
+		if runtime.GOOS == "windows" {
+			binPath += ".exe"
+		}
+		out, err := exec.Command("go", "build", "-o", binPath, "github.com/aryandutt/gvc/cmd").CombinedOutput()
+		if err != nil {
+			buildErr = fmt.Errorf("%v: %s", err, out)
+		}
+	})
+	if buildErr != nil {
+		t.Fatalf("building gvc: %v", buildErr)
+	}
+	return binPath
+}
+
+// runGvc runs gvc with args in dir and returns its output and exit status.
+func runGvc(t *testing.T, dir string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(gvcBinary(t), args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+func TestRepositoryDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := gvc.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(dir, "src", "deep")
+	writeFile(t, filepath.Join(nested, "a.txt"), "a\n")
+	writeFile(t, filepath.Join(dir, "src", "b.txt"), "b\n")
+	outside := t.TempDir()
+
+	// Paths given to add are relative to the directory gvc runs in
+	if out, code := runGvc(t, nested, "add", "a.txt"); code != 0 || strings.Contains(out, "Error") {
+		t.Fatalf("add from a nested directory exited %d:\n%s", code, out)
+	}
+	if out, code := runGvc(t, outside, "-C", filepath.Join(dir, "src"), "add", "b.txt"); code != 0 || strings.Contains(out, "Error") {
+		t.Fatalf("add -C exited %d:\n%s", code, out)
+	}
+	want := "A  src/b.txt\nA  src/deep/a.txt\n"
+	for _, args := range [][]string{
+		{"status", "--porcelain"},
+		{"-C", nested, "status", "--porcelain"},
+		{"--gvc-dir", filepath.Join(dir, ".gvc"), "status", "--porcelain"},
+	} {
+		cwd := outside
+		if args[0] == "status" {
+			cwd = nested
+		}
+		if out, code := runGvc(t, cwd, args...); code != 0 || out != want {
+			t.Errorf("gvc %s exited %d with\n%s\nwant\n%s", strings.Join(args, " "), code, out, want)
+		}
+	}
+
+	if out, _ := runGvc(t, outside, "status"); !strings.Contains(out, "not a gvc repository") {
+		t.Errorf("status outside a repository printed\n%s\nwant not a gvc repository", out)
+	}
+	if out, _ := runGvc(t, outside, "--gvc-dir", nested, "status"); !strings.Contains(out, "not a gvc repository") {
+		t.Errorf("status --gvc-dir of a work tree directory printed\n%s\nwant not a gvc repository", out)
+	}
+}
+
+func TestStatusOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs the executable bit")
+	}
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"both.txt", "deleted.txt", "modified.txt", "removed.txt", "run.sh"} {
+		writeFile(t, filepath.Join(dir, name), "one\n")
+		if err := repo.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head, err := repo.Commit("first", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "both.txt"), "two\n")
+	writeFile(t, filepath.Join(dir, "staged.txt"), "two\n")
+	if err := repo.Add("both.txt", "staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Remove(gvc.RemoveOptions{}, "removed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "both.txt"), "three\n")
+	writeFile(t, filepath.Join(dir, "modified.txt"), "two\n")
+	writeFile(t, filepath.Join(dir, "untracked.txt"), "new\n")
+	if err := os.Remove(filepath.Join(dir, "deleted.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	short := "" +
+		"MM both.txt\n" +
+		" D deleted.txt\n" +
+		" M modified.txt\n" +
+		"D  removed.txt\n" +
+		" M run.sh\n" +
+		"A  staged.txt\n" +
+		"?? untracked.txt\n"
+	one, _ := repo.ObjectFormat().ObjectData("blob", []byte("one\n"))
+	two, _ := repo.ObjectFormat().ObjectData("blob", []byte("two\n"))
+	zero := strings.Repeat("0", len(one))
+	v2 := "" +
+		"1 MM N... 100644 100644 100644 " + one + " " + two + " both.txt\n" +
+		"1 .D N... 100644 100644 000000 " + one + " " + one + " deleted.txt\n" +
+		"1 .M N... 100644 100644 100644 " + one + " " + one + " modified.txt\n" +
+		"1 D. N... 100644 000000 000000 " + one + " " + zero + " removed.txt\n" +
+		"1 .M N... 100644 100644 100755 " + one + " " + one + " run.sh\n" +
+		"1 A. N... 000000 100644 100644 " + zero + " " + two + " staged.txt\n" +
+		"? untracked.txt\n"
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"status", "--short"}, short},
+		{[]string{"status", "-s", "-b"}, "## main\n" + short},
+		{[]string{"status", "--porcelain"}, short},
+		{[]string{"status", "--porcelain=v1"}, short},
+		{[]string{"status", "--porcelain=v2"}, v2},
+		{[]string{"status", "--porcelain=v2", "--branch"}, "# branch.oid " + head + "\n# branch.head main\n" + v2},
+	} {
+		out, code := runGvc(t, dir, test.args...)
+		if code != 0 || out != test.want {
+			t.Errorf("gvc %s exited %d with\n%s\nwant\n%s", strings.Join(test.args, " "), code, out, test.want)
+		}
+	}
+}
+
+func TestFsckExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if out, code := runGvc(t, dir, "fsck"); code != 0 || !strings.Contains(out, "ok") {
+		t.Fatalf("fsck of a clean repository exited %d:\n%s", code, out)
+	}
+
+	// Dangling objects alone are no error
+	writeFile(t, filepath.Join(dir, "a.txt"), "b\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if out, code := runGvc(t, dir, "fsck"); code != 0 || !strings.Contains(out, "dangling blob") {
+		t.Fatalf("fsck with a dangling blob exited %d:\n%s", code, out)
+	}
+
+	missing := strings.Repeat("1", repo.ObjectFormat().HexSize())
+	writeFile(t, filepath.Join(dir, ".gvc", "refs", "heads", "gone"), missing+"\n")
+	out, code := runGvc(t, dir, "fsck")
+	if code != 1 || !strings.Contains(out, "missing commit "+missing) || !strings.Contains(out, "repository is corrupt") {
+		t.Fatalf("fsck with a missing commit exited %d, want 1:\n%s", code, out)
+	}
+}
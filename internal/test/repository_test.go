@@ -0,0 +1,1977 @@
+package test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aryandutt/gvc/pkg/gvc"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTwoRepositories(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	repoA, err := gvc.Init(dirA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoB, err := gvc.Init(dirB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dirA, "src", "a.txt"), "a\n")
+	writeFile(t, filepath.Join(dirB, "b.txt"), "b\n")
+
+	status, err := repoA.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if untracked := status.UntrackedPaths(); len(untracked) != 1 || untracked[0] != "src/a.txt" {
+		t.Fatalf("untracked = %v, want [src/a.txt]", untracked)
+	}
+
+	if err := repoA.Add("src"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repoB.Add("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repoA.Commit("first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repoA.Commit("again", "alice"); !errors.Is(err, gvc.ErrNothingToCommit) {
+		t.Fatalf("second commit err = %v, want ErrNothingToCommit", err)
+	}
+
+	logA, err := repoA.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logA) != 1 {
+		t.Fatalf("len(log) = %d, want 1", len(logA))
+	}
+	logB, err := repoB.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logB) != 0 {
+		t.Fatalf("repo B has %d commits, want 0", len(logB))
+	}
+
+	// Open from a subdirectory finds the same repository
+	sub, err := gvc.Open(filepath.Join(dirA, "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.WorkTree() != repoA.WorkTree() {
+		t.Fatalf("work tree = %s, want %s", sub.WorkTree(), repoA.WorkTree())
+	}
+
+	writeFile(t, filepath.Join(dirA, "src", "a.txt"), "a\nchanged\n")
+	diffs, err := sub.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Path != "src/a.txt" || diffs[0].Status != "modified" {
+		t.Fatalf("diffs = %+v", diffs)
+	}
+}
+
+func TestOpenFromNestedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := gvc.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(dir, "src", "deep")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := gvc.Open(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.WorkTree() != dir {
+		t.Errorf("WorkTree() = %s, want %s", repo.WorkTree(), dir)
+	}
+	// Relative paths are relative to the work tree, not the directory opened
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "a\n")
+	if err := repo.Add("src/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if repo, err = gvc.OpenGvcDir(filepath.Join(dir, ".gvc")); err != nil {
+		t.Fatal(err)
+	}
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := status.StagedPaths(gvc.Added); !slices.Equal(added, []string{"src/a.txt"}) {
+		t.Errorf("staged = %v, want [src/a.txt]", added)
+	}
+
+	if _, err := gvc.Open(t.TempDir()); !errors.Is(err, gvc.ErrNotARepository) {
+		t.Errorf("Open outside a repository: %v, want ErrNotARepository", err)
+	}
+	if _, err := gvc.OpenGvcDir(nested); !errors.Is(err, gvc.ErrNotARepository) {
+		t.Errorf("OpenGvcDir of a work tree directory: %v, want ErrNotARepository", err)
+	}
+}
+
+func TestTreeHashIsStable(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		writeFile(t, filepath.Join(dir, name, "file.txt"), name+"\n")
+		writeFile(t, filepath.Join(dir, name, "sub", "file.txt"), name+"\n")
+	}
+	if err := repo.Add("."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	// Directories must be written in the same order every time
+	for i := 0; i < 5; i++ {
+		if _, err := repo.Commit("again", "alice"); !errors.Is(err, gvc.ErrNothingToCommit) {
+			t.Fatalf("commit %d with an unchanged index: %v, want ErrNothingToCommit", i+2, err)
+		}
+	}
+}
+
+func TestRemoveStagesDeletion(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "keep.txt"), "keep\n")
+	writeFile(t, filepath.Join(dir, "gone.txt"), "gone\n")
+	if err := repo.Add("keep.txt", "gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.Remove(gvc.RemoveOptions{Cached: true}, "gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted := status.StagedPaths(gvc.Deleted); len(deleted) != 1 || deleted[0] != "gone.txt" {
+		t.Fatalf("staged deletions = %v, want [gone.txt]", deleted)
+	}
+	if untracked := status.UntrackedPaths(); len(untracked) != 1 || untracked[0] != "gone.txt" {
+		t.Fatalf("untracked = %v, want [gone.txt]", untracked)
+	}
+
+	if _, err := repo.Commit("remove gone.txt", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	status, err = repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted := status.StagedPaths(gvc.Deleted); len(deleted) != 0 {
+		t.Fatalf("staged deletions after commit = %v, want none", deleted)
+	}
+}
+
+func TestRemoveKeepsLocalModifications(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "edited.txt"), "one\n")
+	writeFile(t, filepath.Join(dir, "staged.txt"), "one\n")
+	if err := repo.Add("edited.txt", "staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "edited.txt"), "two\n")
+	writeFile(t, filepath.Join(dir, "staged.txt"), "two\n")
+	writeFile(t, filepath.Join(dir, "new.txt"), "new\n")
+	if err := repo.Add("staged.txt", "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes only in the work tree or the index would be lost
+	for _, path := range []string{"edited.txt", "staged.txt", "new.txt"} {
+		if _, err := repo.Remove(gvc.RemoveOptions{}, path); err == nil || !strings.Contains(err.Error(), "local modifications") {
+			t.Errorf("rm %s error = %v, want local modifications", path, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Errorf("%s after a refused rm: %v", path, err)
+		}
+	}
+	if _, err := repo.Remove(gvc.RemoveOptions{Cached: true}, "edited.txt"); err != nil {
+		t.Errorf("rm --cached edited.txt: %v", err)
+	}
+	if _, err := repo.Remove(gvc.RemoveOptions{Force: true}, "staged.txt", "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"staged.txt", "new.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); !os.IsNotExist(err) {
+			t.Errorf("%s after rm -f: %v, want it deleted", path, err)
+		}
+	}
+}
+
+func TestGCKeepsHistoryReadable(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := ""
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 200; j++ {
+			content += "line of text that repeats between revisions\n"
+		}
+		writeFile(t, filepath.Join(dir, "data.txt"), content)
+		if err := repo.Add("data.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Commit("revision", "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := repo.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Deltas == 0 {
+		t.Fatalf("expected similar revisions to be stored as deltas, got %+v", result)
+	}
+
+	commits, err := repo.Log()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 5 {
+		t.Fatalf("len(log) = %d, want 5", len(commits))
+	}
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsClean() {
+		t.Fatalf("status after gc is not clean: %+v", status.Entries)
+	}
+}
+
+func TestGCLongHistory(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// More revisions of one file than fit into the delta window
+	var revisions []string
+	content := ""
+	for i := 0; i < 25; i++ {
+		for j := 0; j < 100; j++ {
+			content += fmt.Sprintf("revision %d line %d\n", i, j)
+		}
+		revisions = append(revisions, content)
+		writeFile(t, filepath.Join(dir, "data.txt"), content)
+		if err := repo.Add("data.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Commit(fmt.Sprintf("revision %d", i), "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := repo.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Deltas < len(revisions)/2 {
+		t.Errorf("gc = %+v, want most revisions stored as deltas", result)
+	}
+	for i, want := range revisions {
+		hash, _, err := repo.ResolveRevision(fmt.Sprintf("HEAD~%d:data.txt", len(revisions)-1-i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err := repo.ReadBlob(hash); err != nil || string(data) != want {
+			t.Fatalf("revision %d after gc = %d bytes, %v, want %d bytes", i, len(data), err, len(want))
+		}
+	}
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("fsck after gc reports %v", report.Problems)
+	}
+}
+
+func TestGCUnpackKeepsAge(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"one\n", "two\n"} {
+		writeFile(t, filepath.Join(dir, "a.txt"), content)
+		if err := repo.Add("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Commit(content, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.GC(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Reset("HEAD~1", gvc.ResetHard); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, ".gvc", "logs")); err != nil {
+		t.Fatal(err)
+	}
+	hourAgo := time.Now().Add(-time.Hour).Truncate(time.Second)
+	packs, err := filepath.Glob(filepath.Join(dir, ".gvc", "objects", "pack", "pack-*"))
+	if err != nil || len(packs) != 2 {
+		t.Fatalf("pack files = %v, %v, want a pack and its index", packs, err)
+	}
+	for _, pack := range packs {
+		if err := os.Chtimes(pack, hourAgo, hourAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The commit reset away, its tree and blob leave the pack as loose
+	// objects as old as the pack
+	result, err := repo.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unpacked != 3 {
+		t.Fatalf("gc = %+v, want 3 objects unpacked", result)
+	}
+	for hash := range looseObjectFiles(t, dir) {
+		info, err := os.Stat(filepath.Join(dir, ".gvc", "objects", hash[:2], hash[2:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(hourAgo) {
+			t.Errorf("unpacked object %s dated %v, want the pack's %v", hash, info.ModTime(), hourAgo)
+		}
+	}
+	if pruned, err := repo.Prune("30.minutes.ago", false); err != nil || len(pruned) != 3 {
+		t.Errorf("prune = %v, %v, want the 3 unpacked objects", pruned, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(name string) string {
+		t.Helper()
+		writeFile(t, filepath.Join(dir, name), name+"\n")
+		if err := repo.Add(name); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := repo.Commit(name, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	first := commit("main.txt")
+
+	// Each of these commits is kept by one root only
+	if _, err := repo.Switch("side", gvc.SwitchOptions{Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commit("side.txt")
+	if _, err := repo.Switch("main", gvc.SwitchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	commit("tagged.txt")
+	if _, err := repo.CreateTag("v1", "HEAD", gvc.TagOptions{Message: "release", Tagger: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Reset("HEAD~1", gvc.ResetHard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Switch(first, gvc.SwitchOptions{Detach: true}); err != nil {
+		t.Fatal(err)
+	}
+	commit("detached.txt")
+	writeFile(t, filepath.Join(dir, "staged.txt"), "garbage\n")
+	if err := repo.Add("staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "staged.txt"), "staged.txt\n")
+	if err := repo.Add("staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+	garbage, _ := repo.ObjectFormat().ObjectData("blob", []byte("garbage\n"))
+
+	// Reflogs would keep every commit above, see TestReflogKeepsObjects
+	if err := os.RemoveAll(filepath.Join(dir, ".gvc", "logs")); err != nil {
+		t.Fatal(err)
+	}
+	objectsDir := filepath.Join(dir, ".gvc", "objects")
+	hourAgo := time.Now().Add(-time.Hour)
+	err = filepath.WalkDir(objectsDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, hourAgo, hourAgo)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pruned, err := repo.Prune("2.hours.ago", false); err != nil || len(pruned) != 0 {
+		t.Fatalf("prune --expire=2.hours.ago = %v, %v, want objects newer than the cutoff kept", pruned, err)
+	}
+	garbagePath := filepath.Join(objectsDir, garbage[:2], garbage[2:])
+	pruned, err := repo.Prune("now", true)
+	if err != nil || len(pruned) != 1 || pruned[0].Hash != garbage || pruned[0].Type != "blob" {
+		t.Fatalf("prune --dry-run = %v, %v, want only the blob %s", pruned, err, garbage)
+	}
+	if _, err := os.Stat(garbagePath); err != nil {
+		t.Fatalf("prune --dry-run deleted %s: %v", garbage, err)
+	}
+	pruned, err = repo.Prune("now", false)
+	if err != nil || len(pruned) != 1 || pruned[0].Hash != garbage {
+		t.Fatalf("prune = %v, %v, want only the blob %s", pruned, err, garbage)
+	}
+	if _, err := os.Stat(garbagePath); !os.IsNotExist(err) {
+		t.Fatalf("%s after prune: %v, want it deleted", garbage, err)
+	}
+
+	for _, rev := range []string{"main:main.txt", "side:side.txt", "v1:tagged.txt", "HEAD:detached.txt", ":staged.txt"} {
+		hash, _, err := repo.ResolveRevision(rev)
+		if err != nil {
+			t.Errorf("%s after prune: %v", rev, err)
+			continue
+		}
+		if _, err := repo.ReadBlob(hash); err != nil {
+			t.Errorf("%s after prune: %v", rev, err)
+		}
+	}
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("fsck after prune reports %v, want no problems", report.Problems)
+	}
+}
+
+func TestPruneKeepsRewrittenObjects(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stage := func(content string) {
+		t.Helper()
+		writeFile(t, filepath.Join(dir, "a.txt"), content)
+		if err := repo.Add("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stage("one\n")
+	if _, err := repo.Commit("one", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	stage("two\n")
+	second, err := repo.Commit("two", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.ReadCommit(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Reset("HEAD~1", gvc.ResetHard); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, ".gvc", "logs")); err != nil {
+		t.Fatal(err)
+	}
+	objectsDir := filepath.Join(dir, ".gvc", "objects")
+	hourAgo := time.Now().Add(-time.Hour)
+	for hash := range looseObjectFiles(t, dir) {
+		if err := os.Chtimes(filepath.Join(objectsDir, hash[:2], hash[2:]), hourAgo, hourAgo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modTime := func(hash string) time.Time {
+		t.Helper()
+		info, err := os.Stat(filepath.Join(objectsDir, hash[:2], hash[2:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ModTime()
+	}
+
+	// Adding content that is already stored restarts its grace period, so a
+	// prune before the index or a ref points at it again keeps it
+	blob, _ := repo.ObjectFormat().ObjectData("blob", []byte("two\n"))
+	stage("two\n")
+	stage("three\n")
+	if !modTime(blob).After(hourAgo) {
+		t.Errorf("re-adding blob %s left its mtime at %v", blob, modTime(blob))
+	}
+	pruned, err := repo.Prune("30.minutes.ago", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, object := range pruned {
+		if object.Hash == blob {
+			t.Errorf("prune deleted the re-added blob %s", blob)
+		}
+	}
+	if len(pruned) != 2 {
+		t.Errorf("pruned %v, want the commit and tree reset away", pruned)
+	}
+
+	// Trees are freshened the same way, here by the tree commit writes to
+	// find out there is nothing to commit
+	stage("two\n")
+	if _, err := repo.Commit("two again", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(objectsDir, commit.Tree[:2], commit.Tree[2:]), hourAgo, hourAgo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("nothing", "alice"); !errors.Is(err, gvc.ErrNothingToCommit) {
+		t.Fatalf("commit with an unchanged index: %v, want ErrNothingToCommit", err)
+	}
+	if !modTime(commit.Tree).After(hourAgo) {
+		t.Errorf("committing tree %s again left its mtime at %v", commit.Tree, modTime(commit.Tree))
+	}
+}
+
+func TestFsck(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "dangling\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Commit("first", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.ReadCommit(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := repo.ObjectFormat()
+	// Uncompressed loose objects are read as written by format version 0
+	writeObject := func(hash string, data []byte) {
+		t.Helper()
+		writeFile(t, filepath.Join(dir, ".gvc", "objects", hash[:2], hash[2:]), string(data))
+	}
+	storeObject := func(typ, content string) string {
+		t.Helper()
+		hash, data := format.ObjectData(typ, []byte(content))
+		writeObject(hash, data)
+		return hash
+	}
+
+	// A clean repository has only the blob staged over
+	dangling, _ := format.ObjectData("blob", []byte("dangling\n"))
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := report.Problems; len(problems) != 1 || problems[0].Kind != gvc.FsckDangling || problems[0].Hash != dangling {
+		t.Fatalf("fsck = %v, want only the dangling blob %s", problems, dangling)
+	}
+
+	otherHash, _ := format.ObjectData("blob", []byte("other\n"))
+	_, data := format.ObjectData("blob", []byte("content\n"))
+	writeObject(otherHash, data)
+	badSize, _ := format.ObjectData("blob", []byte("bad size\n"))
+	writeObject(badSize, []byte("blob 99\x00bad size\n"))
+	missingTree := strings.Repeat("1", format.HexSize())
+	missingParent := strings.Repeat("2", format.HexSize())
+	noTree := storeObject("commit", fmt.Sprintf("tree %s\nauthor alice 1700000000 +0000\n\nno tree\n", missingTree))
+	noParent := storeObject("commit", fmt.Sprintf("tree %s\nparent %s\nauthor alice 1700000000 +0000\n\nno parent\n", commit.Tree, missingParent))
+	writeFile(t, filepath.Join(dir, ".gvc", "refs", "heads", "blob"), dangling+"\n")
+
+	report, err = repo.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.HasErrors() {
+		t.Error("fsck of a corrupt repository reports no errors")
+	}
+	found := func(kind, hash, message string) {
+		t.Helper()
+		for _, problem := range report.Problems {
+			if problem.Kind == kind && problem.Hash == hash && strings.Contains(problem.Message, message) {
+				return
+			}
+		}
+		t.Errorf("fsck = %v, want %s %s (%s)", report.Problems, kind, hash, message)
+	}
+	found(gvc.FsckCorrupt, otherHash, "hash mismatch")
+	found(gvc.FsckCorrupt, badSize, "header size")
+	found(gvc.FsckMissing, missingTree, "referenced by commit "+noTree)
+	found(gvc.FsckMissing, missingParent, "referenced by commit "+noParent)
+	found(gvc.FsckBadRef, "refs/heads/blob", "expected a commit")
+	found(gvc.FsckDangling, noTree, "")
+	// The ref keeps the staged-over blob from being dangling now
+	for _, problem := range report.Problems {
+		if problem.Kind == gvc.FsckDangling && problem.Hash == dangling {
+			t.Errorf("fsck reports %v, but a ref points at it", problem)
+		}
+	}
+}
+
+// looseObjectFiles returns the files in .gvc/objects by object hash.
+func looseObjectFiles(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	objectsDir := filepath.Join(dir, ".gvc", "objects")
+	err := filepath.WalkDir(objectsDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Base(filepath.Dir(path)) == "pack" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.Base(filepath.Dir(path))+d.Name()] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// inflate returns the zlib-compressed data decompressed, failing if it is not
+// compressed.
+func inflate(t *testing.T, hash string, data []byte) []byte {
+	t.Helper()
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("object %s is not zlib-compressed: %v", hash, err)
+	}
+	defer zr.Close()
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("inflating object %s: %v", hash, err)
+	}
+	return content
+}
+
+func TestCompressedObjects(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), strings.Repeat("compressible\n", 100))
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Commit("first", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := looseObjectFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("%d loose objects, want a blob, a tree and a commit", len(files))
+	}
+	for hash, data := range files {
+		content := inflate(t, hash, data)
+		if sum := sha1.Sum(content); hex.EncodeToString(sum[:]) != hash {
+			t.Errorf("object %s inflates to content hashing to %x", hash, sum)
+		}
+	}
+	blob, _ := repo.ObjectFormat().ObjectData("blob", []byte(strings.Repeat("compressible\n", 100)))
+	if len(files[blob]) >= 100*len("compressible\n") {
+		t.Errorf("blob takes %d bytes on disk, want it compressed", len(files[blob]))
+	}
+	commit, err := repo.ReadCommit(head)
+	if err != nil || strings.TrimSpace(commit.Message) != "first" {
+		t.Fatalf("ReadCommit = %+v, %v", commit, err)
+	}
+	if data, err := repo.ReadBlob(blob); err != nil || string(data) != strings.Repeat("compressible\n", 100) {
+		t.Fatalf("ReadBlob = %d bytes, %v", len(data), err)
+	}
+}
+
+func TestMigrateUncompressedObjects(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Turn it into a repository written by a gvc without compression
+	for hash, data := range looseObjectFiles(t, dir) {
+		writeFile(t, filepath.Join(dir, ".gvc", "objects", hash[:2], hash[2:]), string(inflate(t, hash, data)))
+	}
+	writeFile(t, filepath.Join(dir, ".gvc", "config"), "[core]\n\trepositoryformatversion = 0\n")
+
+	old, err := gvc.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "b.txt"), "b\n")
+	if err := old.Add("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	head, err := old.Commit("second", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := looseObjectFiles(t, dir)
+	if !bytes.HasPrefix(files[head], []byte("commit ")) {
+		t.Fatalf("version 0 repository wrote a compressed commit")
+	}
+
+	migrated, err := old.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != len(files) {
+		t.Errorf("migrated %d objects, want %d", migrated, len(files))
+	}
+	for hash, data := range looseObjectFiles(t, dir) {
+		inflate(t, hash, data)
+	}
+	if again, err := old.Migrate(); err != nil || again != 0 {
+		t.Errorf("second migration = %d, %v, want nothing to do", again, err)
+	}
+	config, err := os.ReadFile(filepath.Join(dir, ".gvc", "config"))
+	if err != nil || !strings.Contains(string(config), "repositoryformatversion = 1") {
+		t.Fatalf("config after migration = %q, %v, want format version 1", config, err)
+	}
+
+	reopened, err := gvc.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commits, err := reopened.Log(); err != nil || len(commits) != 2 {
+		t.Fatalf("log after migration = %v, %v, want 2 commits", commits, err)
+	}
+	report, err := reopened.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("fsck after migration reports %v", report.Problems)
+	}
+}
+
+func TestMemoryObjectStore(t *testing.T) {
+	dir := t.TempDir()
+	store := gvc.NewMemoryStore()
+	repo, err := gvc.Init(dir, gvc.WithObjectStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Commit("first", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.Has(hash); !ok {
+		t.Fatalf("commit %s not in memory store", hash)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, ".gvc", "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("objects written to disk: %v", entries)
+	}
+
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HasErrors() || report.Objects != 3 {
+		t.Fatalf("fsck = %+v, want 3 objects and no errors", report)
+	}
+}
+
+func TestSHA256Repository(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir, gvc.WithObjectFormat(gvc.SHA256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "hello\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Commit("first", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hash) != 64 {
+		t.Fatalf("commit hash %q is not a sha256 name", hash)
+	}
+	if _, err := repo.GC(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening must pick the format up from the config
+	reopened, err := gvc.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.ObjectFormat() != gvc.SHA256 {
+		t.Fatalf("ObjectFormat() = %s, want sha256", reopened.ObjectFormat().Name)
+	}
+	report, err := reopened.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HasErrors() {
+		t.Fatalf("fsck reported problems: %v", report.Problems)
+	}
+}
+
+func TestBinaryDiff(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "image.bin"), "\x89PNG\x00\x01\x02")
+	if err := repo.Add("image.bin"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "image.bin"), "\x89PNG\x00\x01\x03")
+
+	diffs, err := repo.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Patch != "Binary files a/image.bin and b/image.bin differ\n" {
+		t.Fatalf("unexpected diff: %+v", diffs)
+	}
+}
+
+func TestBigFileDiff(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := strings.Repeat("a line of text\n", 5<<20/15)
+	writeFile(t, filepath.Join(dir, "big.txt"), big)
+	writeFile(t, filepath.Join(dir, "small.txt"), strings.Repeat("x\n", 600))
+	if err := repo.Add("big.txt", "small.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "big.txt"), big+"one more\n")
+	writeFile(t, filepath.Join(dir, "small.txt"), strings.Repeat("x\n", 600)+"y\n")
+	if err := repo.Add("big.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("second", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "big.txt"), big)
+
+	// Text files over the threshold are summarized, in the work tree and in
+	// commits alike
+	const summary = "Binary files a/big.txt and b/big.txt differ\n"
+	diffs, err := repo.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].Patch != summary || !strings.Contains(diffs[1].Patch, "+y") {
+		t.Fatalf("diff = %+v, want big.txt summarized and small.txt diffed", diffs)
+	}
+	diffs, err = repo.DiffRevisions("HEAD~1", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Patch != summary {
+		t.Fatalf("diff HEAD~1 HEAD = %+v, want big.txt summarized", diffs)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, ".gvc", "config"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "\tbigFileThreshold = 1k\n")
+	f.Close()
+	if repo, err = gvc.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	if diffs, err = repo.Diff(); err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[1].Patch != "Binary files a/small.txt and b/small.txt differ\n" {
+		t.Fatalf("diff with core.bigFileThreshold = 1k: %+v, want small.txt summarized", diffs)
+	}
+}
+
+func TestLFSRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.LFSTrack("*.bin"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "asset.bin"), "original asset")
+	if err := repo.Add(".gvcattributes", "asset.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("add asset", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := repo.LFSFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "asset.bin" || !files[0].Present {
+		t.Fatalf("LFSFiles() = %+v", files)
+	}
+
+	if err := repo.Checkout("edit", true); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "asset.bin"), "edited asset")
+	if err := repo.Add("asset.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("edit asset", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("main", false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "asset.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "original asset" {
+		t.Fatalf("checkout wrote %q, want the original content", data)
+	}
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsClean() {
+		t.Fatalf("status after checkout is not clean: %+v", status.Entries)
+	}
+}
+
+func TestChunkedFiles(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, ".gvcattributes"), "*.db chunked\n")
+	original := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(original)
+	writeFile(t, filepath.Join(dir, "data.db"), string(original))
+	if err := repo.Add(".gvcattributes", "data.db"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("add data", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Checkout("edit", true); err != nil {
+		t.Fatal(err)
+	}
+	edited := append([]byte(nil), original...)
+	copy(edited[len(edited)/2:], "edited")
+	writeFile(t, filepath.Join(dir, "data.db"), string(edited))
+	if err := repo.Add("data.db"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("edit data", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("main", false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(original) {
+		t.Fatal("checkout did not reassemble the original chunks")
+	}
+
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HasErrors() {
+		t.Fatalf("fsck reported problems: %v", report.Problems)
+	}
+	// Without sharing the two revisions would need twice the minimum-size chunks
+	if report.Objects > 1<<20/(16<<10)+10 {
+		t.Fatalf("%d objects stored, chunks are not shared", report.Objects)
+	}
+}
+
+func TestStatusNoticesRacyEdit(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "a.txt")
+	writeFile(t, path, "one\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// Same size and, on coarse filesystems, the same mtime as when staged
+	writeFile(t, path, "two\n")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		status, err := repo.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := status.UnstagedPaths(gvc.Modified); len(got) != 1 {
+			t.Fatalf("status %d: unstaged modifications = %v, want [a.txt]", i, got)
+		}
+		// Restore the mtime so only content tells the files apart
+		os.Chtimes(path, info.ModTime(), info.ModTime())
+	}
+}
+
+func TestIndexUpgradeAndCorruption(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An index.json as written by older versions
+	writeFile(t, filepath.Join(dir, "a.txt"), "hello\n")
+	sum := sha1.Sum([]byte("blob 6\x00hello\n"))
+	legacy := `[{"path": "a.txt", "blobHash": "` + hex.EncodeToString(sum[:]) + `", "type": "100644"}]`
+	gvcDir := filepath.Join(dir, ".gvc")
+	os.Remove(filepath.Join(gvcDir, "index"))
+	writeFile(t, filepath.Join(gvcDir, "index.json"), legacy)
+
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status.StagedPaths(gvc.Added); len(got) != 1 || got[0] != "a.txt" {
+		t.Fatalf("staged additions after upgrade = %v, want [a.txt]", got)
+	}
+	if _, err := os.Stat(filepath.Join(gvcDir, "index.json")); !os.IsNotExist(err) {
+		t.Fatalf("index.json was not replaced by the binary index")
+	}
+
+	data, err := os.ReadFile(filepath.Join(gvcDir, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(gvcDir, "index"), string(data[:len(data)-5]))
+	if _, err := repo.Status(); !errors.Is(err, gvc.ErrCorruptIndex) {
+		t.Fatalf("Status() on a truncated index returned %v, want ErrCorruptIndex", err)
+	}
+}
+
+func TestLockFiles(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+
+	// A fresh lock may belong to a process that is about to take it
+	lockPath := filepath.Join(dir, ".gvc", "index.lock")
+	writeFile(t, lockPath, "")
+	if err := repo.Add(filepath.Join(dir, "a.txt")); !errors.Is(err, gvc.ErrLocked) {
+		t.Fatalf("Add() with a held index lock returned %v, want ErrLocked", err)
+	}
+
+	// Nothing holds it once it is old, so it is stale
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("stale locks are only detected with flock")
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatalf("Add() with a stale index lock: %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatalf("index.lock left behind after Add()")
+	}
+	if _, err := repo.Commit("first", "tester"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanKeepsConcurrentAdd(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for i := 0; i < 200; i++ {
+		files = append(files, fmt.Sprintf("f%03d.txt", i))
+		writeFile(t, filepath.Join(dir, files[i]), strings.Repeat(files[i], 1000))
+	}
+	if err := repo.Add(files...); err != nil {
+		t.Fatal(err)
+	}
+
+	for round := 0; round < 20; round++ {
+		// New modification times make the scan hash every file and refresh
+		// their stat data in the index
+		stamp := time.Now().Add(time.Duration(-round-2) * time.Minute)
+		for _, file := range files {
+			if err := os.Chtimes(filepath.Join(dir, file), stamp, stamp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		added := fmt.Sprintf("new%02d.txt", round)
+		writeFile(t, filepath.Join(dir, added), added)
+
+		done := make(chan error)
+		go func() {
+			_, err := repo.Status()
+			done <- err
+		}()
+		for {
+			err := repo.Add(added)
+			if !errors.Is(err, gvc.ErrLocked) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		status, err := repo.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if staged := status.StagedPaths(gvc.Added); !slices.Contains(staged, added) {
+			t.Fatalf("round %d: %s is no longer staged after a concurrent scan", round, added)
+		}
+	}
+}
+
+func TestInterruptedCheckout(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "main\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("first", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("topic", true); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "topic\n")
+	writeFile(t, filepath.Join(dir, "sub", "b.txt"), "new\n")
+	if err := repo.Add("a.txt", "sub/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("second", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("main", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// An untracked file in the way stops the switch before anything changes
+	writeFile(t, filepath.Join(dir, "sub", "b.txt"), "untracked\n")
+	if err := repo.Checkout("topic", false); err == nil {
+		t.Fatalf("Checkout() overwrote an untracked file")
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the blob of sub/b.txt the switch fails halfway
+	sum := sha1.Sum([]byte("blob 4\x00new\n"))
+	hash := hex.EncodeToString(sum[:])
+	blobPath := filepath.Join(dir, ".gvc", "objects", hash[:2], hash[2:])
+	blob, err := os.ReadFile(blobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(blobPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("topic", false); err == nil {
+		t.Fatalf("Checkout() succeeded without the blob of sub/b.txt")
+	}
+	if err := repo.Add("a.txt"); !errors.Is(err, gvc.ErrCheckoutInterrupted) {
+		t.Fatalf("Add() during an interrupted checkout returned %v, want ErrCheckoutInterrupted", err)
+	}
+
+	if err := repo.AbortCheckout(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "main\n" {
+		t.Fatalf("a.txt after abort = %q, want %q", data, "main\n")
+	}
+	if branch, _ := repo.CurrentBranch(); branch != "main" {
+		t.Fatalf("branch after abort = %s, want main", branch)
+	}
+
+	// With the blob back the switch completes
+	writeFile(t, blobPath, string(blob))
+	if err := repo.Checkout("topic", false); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "sub", "b.txt")); string(data) != "new\n" {
+		t.Fatalf("sub/b.txt after switch = %q, want %q", data, "new\n")
+	}
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if untracked := status.UntrackedPaths(); len(untracked) != 0 {
+		t.Fatalf("untracked after switch = %v, want none", untracked)
+	}
+}
+
+func TestExecutableMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no executable bit on windows")
+	}
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "run.sh")
+	writeFile(t, script, "#!/bin/sh\n")
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add("run.sh"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("add script", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dropping the executable bit is a change of its own
+	if err := os.Chmod(script, 0644); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := repo.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].OldMode != "100755" || diffs[0].NewMode != "100644" || diffs[0].Patch != "" {
+		t.Fatalf("Diff() = %+v, want a mode change from 100755 to 100644", diffs)
+	}
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checkout restores the bit
+	if err := repo.Checkout("empty", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Remove(gvc.RemoveOptions{}, "run.sh"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("remove script", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("main", false); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Fatalf("run.sh checked out with mode %v, want it executable", info.Mode())
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("a.txt", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", filepath.Join(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add("a.txt", "link", "dangling"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("links", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsClean() {
+		t.Fatalf("status after commit = %+v, want clean", status.Entries)
+	}
+
+	// Retargeting the link is a modification, even though the content it
+	// points to is the same
+	writeFile(t, filepath.Join(dir, "b.txt"), "a\n")
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("b.txt", link); err != nil {
+		t.Fatal(err)
+	}
+	status, err = repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified := status.UnstagedPaths(gvc.Modified); len(modified) != 1 || modified[0] != "link" {
+		t.Fatalf("unstaged modifications = %v, want [link]", modified)
+	}
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Checkout recreates the links
+	if err := repo.Checkout("nolinks", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Remove(gvc.RemoveOptions{}, "link", "dangling"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("remove links", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Checkout("main", false); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"link": "a.txt", "dangling": "missing"} {
+		target, err := os.Readlink(filepath.Join(dir, name))
+		if err != nil || target != want {
+			t.Fatalf("%s after checkout points to %q (%v), want %q", name, target, err, want)
+		}
+	}
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, ".gvcignore"), "build/\n*.log\n!keep.log\n/gvc\nvendor/**/*.go\n")
+	writeFile(t, filepath.Join(dir, "src", ".gvcignore"), "gen/\n")
+	writeFile(t, filepath.Join(dir, ".gvc", "info", "exclude"), "*.swp\n")
+	for _, name := range []string{"build/out.o", "x.log", "keep.log", "gvc", "src/gvc", "vendor/a/b/c.go", "src/gen/z.go", "src/main.go", "a.swp"} {
+		writeFile(t, filepath.Join(dir, name), name+"\n")
+	}
+
+	if err := repo.Add("."); err != nil {
+		t.Fatal(err)
+	}
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".gvcignore", "keep.log", "src/.gvcignore", "src/gvc", "src/main.go"}
+	if got := status.StagedPaths(gvc.Added); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("staged by add . = %v, want %v", got, want)
+	}
+	if untracked := status.UntrackedPaths(); len(untracked) != 0 {
+		t.Fatalf("untracked = %v, want none", untracked)
+	}
+
+	match, err := repo.CheckIgnore("src/gen/z.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match == nil || match.Source != "src/.gvcignore" || match.Line != 1 {
+		t.Fatalf("CheckIgnore(src/gen/z.go) = %+v, want src/.gvcignore line 1", match)
+	}
+	if match, err := repo.CheckIgnore("keep.log"); err != nil || match != nil {
+		t.Fatalf("CheckIgnore(keep.log) = %+v, %v, want tracked files never ignored", match, err)
+	}
+
+	removed, err := repo.Clean(gvc.CleanOptions{Ignored: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 6 {
+		t.Fatalf("Clean() removed %v, want the 6 ignored files", removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build")); !os.IsNotExist(err) {
+		t.Fatalf("Clean() left the emptied build directory")
+	}
+}
+
+func TestParallelScan(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		writeFile(t, filepath.Join(dir, fmt.Sprintf("d%d", i%5), fmt.Sprintf("f%d.txt", i)), fmt.Sprintf("file %d\n", i))
+	}
+	if err := repo.Add("."); err != nil {
+		t.Fatal(err)
+	}
+	// Sibling directories each become their own tree
+	if _, err := repo.Commit("many files", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "d3", "f8.txt"), "changed\n")
+	writeFile(t, filepath.Join(dir, "d4", "new.txt"), "new\n")
+
+	// The default pool, then a single worker
+	for _, workers := range []string{"default", "1"} {
+		if workers != "default" {
+			f, err := os.OpenFile(filepath.Join(dir, ".gvc", "config"), os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintf(f, "\tworkers = %s\n", workers)
+			f.Close()
+			if repo, err = gvc.Open(dir); err != nil {
+				t.Fatal(err)
+			}
+		}
+		status, err := repo.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := status.UnstagedPaths(gvc.Modified); len(got) != 1 || got[0] != "d3/f8.txt" {
+			t.Errorf("workers=%s: modified = %v, want [d3/f8.txt]", workers, got)
+		}
+		if got := status.UntrackedPaths(); len(got) != 1 || got[0] != "d4/new.txt" {
+			t.Errorf("workers=%s: untracked = %v, want [d4/new.txt]", workers, got)
+		}
+	}
+}
+
+func TestFSMonitorShortIdle(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fsmonitor needs inotify")
+	}
+	repo, err := gvc.Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without queries the daemon exits after the shortest idle tick
+	done := make(chan error, 1)
+	go func() { done <- repo.RunFSMonitor(5 * time.Nanosecond) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("fsmonitor with a 5ns idle time did not exit")
+	}
+}
+
+func TestFSMonitor(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fsmonitor needs inotify")
+	}
+	dir := t.TempDir()
+	if _, err := gvc.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, ".gvc", "config"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, "\tfsmonitor = true\n")
+	f.Close()
+	repo, err := gvc.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a", "one.txt"), "one\n")
+	writeFile(t, filepath.Join(dir, "two.txt"), "two\n")
+	if err := repo.Add("."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("first", "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- repo.RunFSMonitor(time.Minute) }()
+	for i := 0; !repo.FSMonitorRunning(); i++ {
+		if i == 100 {
+			t.Fatal("fsmonitor did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer func() {
+		if err := repo.StopFSMonitor(); err != nil {
+			t.Error(err)
+		}
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	check := func(step string, modified, deleted, untracked []string) {
+		t.Helper()
+		status, err := repo.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprint(status.UnstagedPaths(gvc.Modified), status.UnstagedPaths(gvc.Deleted), status.UntrackedPaths())
+		if want := fmt.Sprint(modified, deleted, untracked); got != want {
+			t.Errorf("%s: status = %s, want %s", step, got, want)
+		}
+	}
+	// The first scan walks the tree, the others only look at what changed
+	check("clean", nil, nil, nil)
+	check("still clean", nil, nil, nil)
+	writeFile(t, filepath.Join(dir, "a", "one.txt"), "changed\n")
+	writeFile(t, filepath.Join(dir, "b", "c", "new.txt"), "new\n")
+	check("edits", []string{"a/one.txt"}, nil, []string{"b/c/new.txt"})
+	os.Remove(filepath.Join(dir, "two.txt"))
+	writeFile(t, filepath.Join(dir, ".gvcignore"), "b/\n")
+	check("ignored", []string{"a/one.txt"}, []string{"two.txt"}, []string{".gvcignore"})
+	writeFile(t, filepath.Join(dir, "a", "one.txt"), "one\n")
+	check("restored", nil, []string{"two.txt"}, []string{".gvcignore"})
+}
+
+func TestTags(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commits []string
+	for _, content := range []string{"one\n", "two\n"} {
+		writeFile(t, filepath.Join(dir, "a.txt"), content)
+		if err := repo.Add("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := repo.Commit(content, "tester")
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, hash)
+	}
+	if _, err := repo.CreateTag("v1.9", commits[0], gvc.TagOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	annotated, err := repo.CreateTag("v1.10", "", gvc.TagOptions{Message: "Release", Tagger: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !annotated.Annotated() || annotated.Object != commits[1] {
+		t.Fatalf("annotated tag = %+v, want a tag object for %s", annotated, commits[1])
+	}
+	if _, err := repo.CreateTag("v1.9", "", gvc.TagOptions{}); err == nil {
+		t.Error("replacing a tag without force succeeded")
+	}
+	// A refused annotated tag must not leave a dangling tag object for fsck
+	if _, err := repo.CreateTag("v1.10", commits[0], gvc.TagOptions{Message: "Again", Tagger: "tester"}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("replacing an annotated tag without force: %v, want already exists", err)
+	}
+
+	tags, err := repo.Tags(gvc.TagListOptions{Patterns: []string{"v1.*"}, Sort: "version:refname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Name != "v1.9" || tags[1].Name != "v1.10" || tags[1].Message != "Release" {
+		t.Fatalf("tags = %+v, want v1.9 then the annotated v1.10", tags)
+	}
+	if hash, err := repo.ResolveCommit("v1.10"); err != nil || hash != commits[1] {
+		t.Errorf("ResolveCommit(v1.10) = %s, %v, want %s", hash, err, commits[1])
+	}
+	if log, err := repo.LogFrom("v1.9"); err != nil || len(log) != 1 {
+		t.Errorf("LogFrom(v1.9) = %d commits, %v, want 1", len(log), err)
+	}
+
+	// Packing keeps the tag object, and fsck follows it
+	if _, err := repo.GC(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("fsck problems after gc: %+v", report.Problems)
+	}
+	if _, err := repo.DeleteTag("v1.10"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ResolveCommit("v1.10"); err == nil {
+		t.Error("deleted tag still resolves")
+	}
+}
+
+func TestDetachedHead(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(content string) string {
+		t.Helper()
+		writeFile(t, filepath.Join(dir, "a.txt"), content)
+		if err := repo.Add("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := repo.Commit(content, "tester")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	first := commit("one\n")
+	commit("two\n")
+
+	if left, err := repo.Switch(first, gvc.SwitchOptions{Detach: true}); err != nil || len(left) != 0 {
+		t.Fatalf("detaching = %v, %v, want no commits left behind", left, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !head.Detached() || head.Commit != first {
+		t.Fatalf("head = %+v, want detached at %s", head, first)
+	}
+	status, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Branch != "" || status.Head != first {
+		t.Errorf("status branch %q head %s, want detached at %s", status.Branch, status.Head, first)
+	}
+
+	// Commits made while detached only move HEAD, and are reported when left
+	detached := commit("three\n")
+	if head, _ := repo.Head(); head.Commit != detached {
+		t.Errorf("HEAD = %s after a detached commit, want %s", head.Commit, detached)
+	}
+	left, err := repo.Switch("main", gvc.SwitchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].Hash != detached {
+		t.Errorf("left behind = %v, want [%s]", left, detached)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "two\n" {
+		t.Errorf("a.txt = %q, %v after switching back, want two", data, err)
+	}
+}
+
+func TestNestedBranches(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "one\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("one", "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Switch("feature/x", gvc.SwitchOptions{Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Switch("main", gvc.SwitchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Switch("feature/x", gvc.SwitchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	branches, err := repo.Branches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []gvc.Branch{{Name: "feature/x", Current: true}, {Name: "main"}}
+	if !slices.Equal(branches, want) {
+		t.Errorf("branches = %v, want %v", branches, want)
+	}
+}
+
+func TestUnbornBranches(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Branches are unborn until their first commit, so switching between
+	// them in an empty repository only moves HEAD
+	if _, err := repo.Switch("a", gvc.SwitchOptions{Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".gvc", "refs", "heads", "a")); !os.IsNotExist(err) {
+		t.Errorf("creating a branch without a commit wrote its ref: %v", err)
+	}
+	for _, branch := range []string{"main", "a"} {
+		if _, err := repo.Switch(branch, gvc.SwitchOptions{}); err != nil {
+			t.Fatalf("switch %s: %v", branch, err)
+		}
+	}
+	// Empty refs as written by earlier versions count as unborn too
+	writeFile(t, filepath.Join(dir, ".gvc", "refs", "heads", "old"), "")
+	if _, err := repo.Switch("old", gvc.SwitchOptions{}); err != nil {
+		t.Fatalf("switch to an empty ref: %v", err)
+	}
+	if _, err := repo.Switch("a", gvc.SwitchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	if err := repo.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Commit("first", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.ResolveCommit("a"); err != nil || got != hash {
+		t.Fatalf("a = %s, %v, want %s", got, err, hash)
+	}
+	if _, err := repo.Switch("missing", gvc.SwitchOptions{}); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("switch to a missing branch with commits = %v, want does not exist", err)
+	}
+	if _, err := repo.Switch("a", gvc.SwitchOptions{Create: true}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("switch -c to an existing branch = %v, want already exists", err)
+	}
+	if _, err := repo.Switch("b", gvc.SwitchOptions{Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.ResolveCommit("b"); err != nil || got != hash {
+		t.Errorf("b = %s, %v, want %s", got, err, hash)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []string
+	for i := 1; i <= 3; i++ {
+		writeFile(t, filepath.Join(dir, "src", "a.txt"), fmt.Sprintf("v%d\n", i))
+		if err := repo.Add("src/a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := repo.Commit(fmt.Sprintf("c%d", i), "tester")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	for rev, want := range map[string]string{
+		"HEAD~2":            hashes[0],
+		"main^":             hashes[1],
+		"HEAD^0":            hashes[2],
+		hashes[0][:7]:       hashes[0],
+		"main@{1}":          hashes[1],
+		"HEAD~1^{commit}":   hashes[1],
+		"@{2}":              hashes[0],
+		hashes[2][:5] + "~": hashes[1],
+	} {
+		if got, err := repo.ResolveCommit(rev); err != nil || got != want {
+			t.Errorf("ResolveCommit(%q) = %s, %v, want %s", rev, got, err, want)
+		}
+	}
+	for _, rev := range []string{"HEAD~3", "HEAD^2", "nosuch", "main@{9}"} {
+		if _, err := repo.ResolveCommit(rev); !errors.Is(err, gvc.ErrUnknownRevision) {
+			t.Errorf("ResolveCommit(%q) error = %v, want ErrUnknownRevision", rev, err)
+		}
+	}
+	for _, rev := range []string{"HEAD~-1", "HEAD~1x", "HEAD^foo", "HEAD^{commit"} {
+		if _, err := repo.ResolveCommit(rev); err == nil || !strings.Contains(err.Error(), "invalid revision") {
+			t.Errorf("ResolveCommit(%q) error = %v, want an invalid revision", rev, err)
+		}
+	}
+	hash, typ, err := repo.ResolveRevision("HEAD~1:src/a.txt")
+	if err != nil || typ != "blob" {
+		t.Fatalf("ResolveRevision(HEAD~1:src/a.txt) = %s, %s, %v", hash, typ, err)
+	}
+	if data, err := repo.ReadBlob(hash); err != nil || string(data) != "v2\n" {
+		t.Errorf("HEAD~1:src/a.txt = %q, %v, want v2", data, err)
+	}
+
+	// The blobs of these two files share the hash prefix 9a80
+	writeFile(t, filepath.Join(dir, "p.txt"), "x70\n")
+	writeFile(t, filepath.Join(dir, "q.txt"), "x167\n")
+	if err := repo.Add("p.txt", "q.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.ResolveRevision("9a80"); !errors.Is(err, gvc.ErrAmbiguousRevision) {
+		t.Errorf("ResolveRevision(9a80) error = %v, want ErrAmbiguousRevision", err)
+	}
+
+	rng, ok := gvc.ParseRange("HEAD~2..")
+	if !ok {
+		t.Fatal("HEAD~2.. is not parsed as a range")
+	}
+	if commits, err := repo.LogRange(rng); err != nil || len(commits) != 2 || commits[0].Hash != hashes[2] {
+		t.Errorf("log HEAD~2.. = %v, %v, want the last two commits", commits, err)
+	}
+	diffs, err := repo.DiffRevisions("HEAD~2", "HEAD")
+	if err != nil || len(diffs) != 1 || diffs[0].Path != "src/a.txt" || !strings.Contains(diffs[0].Patch, "+v3") {
+		t.Errorf("diff HEAD~2 HEAD = %+v, %v", diffs, err)
+	}
+
+	// A hard reset discards changes and is undone through the reflog
+	writeFile(t, filepath.Join(dir, "src", "a.txt"), "local\n")
+	if _, err := repo.Reset("HEAD~2", gvc.ResetHard); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "src", "a.txt")); err != nil || string(data) != "v1\n" {
+		t.Errorf("src/a.txt = %q, %v after reset --hard, want v1", data, err)
+	}
+	if got, err := repo.Reset("main@{1}", gvc.ResetSoft); err != nil || got != hashes[2] {
+		t.Errorf("reset --soft main@{1} = %s, %v, want %s", got, err, hashes[2])
+	}
+}
+
+func TestReflogKeepsObjects(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := gvc.Init(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		writeFile(t, filepath.Join(dir, "a.txt"), fmt.Sprintf("v%d\n", i))
+		if err := repo.Add("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Commit(fmt.Sprintf("c%d", i), "tester"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.Reset("HEAD~1", gvc.ResetHard); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dropped commit is only named by the reflogs now
+	if pruned, err := repo.Prune("now", false); err != nil || len(pruned) != 0 {
+		t.Fatalf("prune = %v, %v, want nothing pruned", pruned, err)
+	}
+	if _, err := repo.GC(); err != nil {
+		t.Fatal(err)
+	}
+	hash, _, err := repo.ResolveRevision("HEAD@{1}:a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := repo.ReadBlob(hash); err != nil || string(data) != "v2\n" {
+		t.Errorf("HEAD@{1}:a.txt = %q, %v, want v2", data, err)
+	}
+	report, err := repo.Fsck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("fsck reports %v, want no problems", report.Problems)
+	}
+}
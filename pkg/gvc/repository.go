@@ -0,0 +1,628 @@
+// Package gvc is the public Go API for gvc repositories.
+//
+// A Repository is bound to its own work tree rather than the process working
+// directory, so several repositories can be used at once:
+//
+//	repo, err := gvc.Open("path/to/project")
+//	if err != nil {
+//		return err
+//	}
+//	if err := repo.Add("main.go"); err != nil {
+//		return err
+//	}
+//	hash, err := repo.Commit("Add main.go", "alice")
+package gvc
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/aryandutt/gvc/internal/core"
+)
+
+// ErrNotARepository is returned by Open when no enclosing repository exists.
+var ErrNotARepository = core.ErrNotARepository
+
+// ErrCorruptIndex is returned when the index file fails validation.
+var ErrCorruptIndex = core.ErrCorruptIndex
+
+// ErrLocked is returned when another process holds a lock on the index, a
+// ref or the config.
+var ErrLocked = core.ErrLocked
+
+// ErrCheckoutInterrupted is returned by commands that change the index or
+// work tree while a checkout that did not finish awaits ContinueCheckout or
+// AbortCheckout.
+var ErrCheckoutInterrupted = core.ErrCheckoutInterrupted
+
+// ErrFSMonitorUnsupported is returned by RunFSMonitor and StartFSMonitor on
+// platforms without a file system monitor (anything but Linux).
+var ErrFSMonitorUnsupported = core.ErrFSMonitorUnsupported
+
+// ErrFSMonitorRunning is returned by RunFSMonitor when a daemon already
+// watches the repository.
+var ErrFSMonitorRunning = core.ErrFSMonitorRunning
+
+// ErrUnknownRevision is returned for a revision that names nothing.
+var ErrUnknownRevision = core.ErrUnknownRevision
+
+// ErrAmbiguousRevision is returned for a hash prefix that matches more than
+// one object.
+var ErrAmbiguousRevision = core.ErrAmbiguousRevision
+
+// ErrNothingToCommit is returned by Commit when the index matches HEAD.
+var ErrNothingToCommit = errors.New("nothing to commit, working tree clean")
+
+// Commit is a commit object read from the repository.
+type Commit = core.Commit
+
+// Status summarizes the index and working directory, see Repository.Status.
+type Status = core.StatusReport
+
+// StatusEntry is the state of a single path within a Status.
+type StatusEntry = core.StatusEntry
+
+// ChangeType is a single-letter status code such as 'M' for modified.
+type ChangeType = core.ChangeType
+
+const (
+	Unmodified = core.Unmodified
+	Added      = core.Added
+	Modified   = core.Modified
+	Deleted    = core.Deleted
+	Untracked  = core.Untracked
+)
+
+// GCResult describes the work done by Repository.GC.
+type GCResult = core.GCResult
+
+// PrunedObject is an unreachable object reported by Repository.Prune.
+type PrunedObject = core.PrunedObject
+
+// FsckReport is the result of Repository.Fsck.
+type FsckReport = core.FsckReport
+
+// Kinds of FsckProblem.
+const (
+	FsckCorrupt  = core.FsckCorrupt
+	FsckMissing  = core.FsckMissing
+	FsckBadRef   = core.FsckBadRef
+	FsckDangling = core.FsckDangling
+)
+
+// FileDiff is the difference of one file, see Repository.Diff.
+type FileDiff = core.FileDiff
+
+// TreeEntry is a file or directory in a tree object.
+type TreeEntry = core.TreeEntry
+
+// RevisionRange is a range of history such as "main..topic", see ParseRange.
+type RevisionRange = core.RevisionRange
+
+// ParseRange splits "from..to" (commits reachable from to but not from) or
+// "from...to" (reachable from either but not both) into a RevisionRange,
+// with HEAD for an omitted side. It reports false for a single revision.
+func ParseRange(expr string) (RevisionRange, bool) {
+	return core.ParseRange(expr)
+}
+
+// ResetMode selects what Repository.Reset changes besides the branch.
+type ResetMode = core.ResetMode
+
+// Reset modes, as for git reset --mixed, --soft and --hard.
+const (
+	ResetMixed = core.ResetMixed
+	ResetSoft  = core.ResetSoft
+	ResetHard  = core.ResetHard
+)
+
+// ReflogEntry is one change of a ref, see Repository.Reflog.
+type ReflogEntry = core.ReflogEntry
+
+// Branch is a branch name and whether HEAD points to it.
+type Branch struct {
+	Name    string
+	Current bool
+}
+
+// ObjectStore is a content-addressed store for blobs, trees and commits.
+type ObjectStore = core.ObjectStore
+
+// MemoryStore is an ObjectStore that never touches disk.
+type MemoryStore = core.MemoryStore
+
+// CachingStore is a read-through cache around another ObjectStore.
+type CachingStore = core.CachingStore
+
+// ErrObjectNotFound is returned by ObjectStore.Get for unknown hashes.
+var ErrObjectNotFound = core.ErrObjectNotFound
+
+// NewMemoryStore returns an empty in-memory object store.
+func NewMemoryStore() *MemoryStore {
+	return core.NewMemoryStore()
+}
+
+// NewCachingStore wraps inner with an LRU cache of at most maxBytes.
+func NewCachingStore(inner ObjectStore, maxBytes int) *CachingStore {
+	return core.NewCachingStore(inner, maxBytes)
+}
+
+// NewFileStore returns the on-disk store for an objects directory such as
+// ".gvc/objects" holding objects named in format. New objects are
+// zlib-compressed when compress is set.
+func NewFileStore(dir string, format *ObjectFormat, compress bool) ObjectStore {
+	return core.NewFileStore(dir, format, compress)
+}
+
+// ObjectFormat is the hash algorithm used to name objects.
+type ObjectFormat = core.ObjectFormat
+
+// Supported object formats.
+var (
+	SHA1   = core.SHA1
+	SHA256 = core.SHA256
+)
+
+// LookupObjectFormat returns the object format called name ("sha1" or "sha256").
+func LookupObjectFormat(name string) (*ObjectFormat, error) {
+	return core.LookupObjectFormat(name)
+}
+
+type options struct {
+	objects ObjectStore
+	format  *ObjectFormat
+}
+
+// Option configures a repository opened by Init, Open or OpenGvcDir.
+type Option func(*options)
+
+// WithObjectStore keeps the repository's objects in store instead of
+// .gvc/objects. Commands that work on the on-disk layout, such as GC and
+// Prune, are not available with other stores.
+func WithObjectStore(store ObjectStore) Option {
+	return func(o *options) {
+		o.objects = store
+	}
+}
+
+// WithObjectFormat selects the hash algorithm for a repository created by
+// Init; the default is SHA1. Existing repositories keep the format they were
+// created with and ignore this option.
+func WithObjectFormat(format *ObjectFormat) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// Repository is an open gvc repository.
+type Repository struct {
+	repo *core.Repo
+}
+
+func collectOptions(opts []Option) options {
+	o := options{format: SHA1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func newRepository(repo *core.Repo, opts []Option) *Repository {
+	if o := collectOptions(opts); o.objects != nil {
+		repo.Objects = o.objects
+	}
+	return &Repository{repo: repo}
+}
+
+// Init creates a new repository with its work tree at path.
+func Init(path string, opts ...Option) (*Repository, error) {
+	repo, err := core.InitRepo(path, collectOptions(opts).format)
+	if err != nil {
+		return nil, err
+	}
+	return newRepository(repo, opts), nil
+}
+
+// Open opens the repository containing path, searching parent directories
+// for the .gvc directory.
+func Open(path string, opts ...Option) (*Repository, error) {
+	repo, err := core.FindRepo(path)
+	if err != nil {
+		return nil, err
+	}
+	return newRepository(repo, opts), nil
+}
+
+// OpenGvcDir opens the repository whose metadata lives in gvcDir.
+func OpenGvcDir(gvcDir string, opts ...Option) (*Repository, error) {
+	repo, err := core.OpenRepo(gvcDir)
+	if err != nil {
+		return nil, err
+	}
+	return newRepository(repo, opts), nil
+}
+
+// WorkTree returns the absolute path of the repository's work tree.
+func (r *Repository) WorkTree() string {
+	return r.repo.WorkTree
+}
+
+// ObjectFormat returns the hash algorithm the repository names objects with.
+func (r *Repository) ObjectFormat() *ObjectFormat {
+	return r.repo.Format
+}
+
+// Add stages files or directories. Relative paths are resolved against the
+// work tree.
+func (r *Repository) Add(paths ...string) error {
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.repo.WorkTree, path)
+		}
+		if err := r.repo.AddToStage(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveOptions controls Repository.Remove.
+type RemoveOptions struct {
+	Cached    bool // Only remove from the index, keep the working tree file
+	Recursive bool // Allow removing every tracked file below a directory
+	Force     bool // Delete work tree files even if they have changes not in HEAD
+}
+
+// Remove stages the deletion of tracked files and returns the removed paths.
+// Relative paths are resolved against the work tree.
+func (r *Repository) Remove(opts RemoveOptions, paths ...string) ([]string, error) {
+	var removed []string
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.repo.WorkTree, path)
+		}
+		files, err := r.repo.RemoveFromStage(path, opts.Cached, opts.Recursive, opts.Force)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, files...)
+	}
+	return removed, nil
+}
+
+// Commit records the index as a new commit on the current branch and returns
+// its hash. It returns ErrNothingToCommit if the index matches HEAD.
+func (r *Repository) Commit(message, author string) (string, error) {
+	isFirstCommit, err := r.repo.IsFirstCommit()
+	if err != nil {
+		return "", err
+	}
+	if !isFirstCommit {
+		same, err := r.repo.CompareHeadAndIndex()
+		if err != nil {
+			return "", err
+		}
+		if same {
+			return "", ErrNothingToCommit
+		}
+	}
+	return r.repo.CreateCommit(message, author)
+}
+
+// Log returns the history of the current branch, newest first.
+func (r *Repository) Log() ([]*Commit, error) {
+	return r.repo.LogCommits()
+}
+
+// LogFrom returns the history of the commit rev names, newest first. rev is
+// any revision ResolveRevision accepts.
+func (r *Repository) LogFrom(rev string) ([]*Commit, error) {
+	return r.repo.LogFrom(rev)
+}
+
+// LogRange returns the commits in rng, newest first.
+func (r *Repository) LogRange(rng RevisionRange) ([]*Commit, error) {
+	return r.repo.LogRange(rng)
+}
+
+// ResolveRevision returns the hash and type of the object rev names. A
+// revision is "HEAD", a branch, a tag, a full ref name, or a full or unique
+// abbreviated hash, optionally followed by suffixes: ~n for the n-th
+// ancestor, ^n for the n-th parent, ^{type} to peel tags and commits, and
+// @{n} on a ref name for its value n changes ago. "<rev>:<path>" names the
+// blob or tree at path in a commit, and ":<path>" the staged blob.
+func (r *Repository) ResolveRevision(rev string) (string, string, error) {
+	return r.repo.ResolveRevision(rev)
+}
+
+// ResolveCommit returns the hash of the commit rev names, following
+// annotated tags to the commit they tag.
+func (r *Repository) ResolveCommit(rev string) (string, error) {
+	return r.repo.ResolveCommit(rev)
+}
+
+// ReadCommit returns the commit with the given hash.
+func (r *Repository) ReadCommit(hash string) (*Commit, error) {
+	return r.repo.GetCommit(hash)
+}
+
+// ReadTag returns the annotated tag object with the given hash.
+func (r *Repository) ReadTag(hash string) (*Tag, error) {
+	return r.repo.GetTag(hash)
+}
+
+// ReadTree returns the entries of the tree with the given hash.
+func (r *Repository) ReadTree(hash string) ([]TreeEntry, error) {
+	return r.repo.GetTree(hash)
+}
+
+// ReadBlob returns the content of the file object with the given hash.
+func (r *Repository) ReadBlob(hash string) ([]byte, error) {
+	return r.repo.ReadBlobData(hash)
+}
+
+// Reflog returns the changes of HEAD, a branch or a full ref name, newest
+// first. An empty name stands for the current branch.
+func (r *Repository) Reflog(name string) ([]ReflogEntry, error) {
+	return r.repo.Reflog(name)
+}
+
+// Reset points the current branch, or HEAD when detached, at the commit rev
+// names and returns its hash. ResetMixed also makes the index match the
+// commit, and ResetHard the working directory as well, discarding local
+// changes to tracked files.
+func (r *Repository) Reset(rev string, mode ResetMode) (string, error) {
+	return r.repo.Reset(rev, mode)
+}
+
+// Status reports staged, unstaged and untracked changes.
+func (r *Repository) Status() (*Status, error) {
+	return r.repo.Status()
+}
+
+// Diff returns the differences between the working directory and the index.
+func (r *Repository) Diff() ([]FileDiff, error) {
+	return r.repo.Diff()
+}
+
+// DiffWorkTree returns the differences between the commit rev names and the
+// tracked files in the working directory.
+func (r *Repository) DiffWorkTree(rev string) ([]FileDiff, error) {
+	return r.repo.DiffWorkTree(rev)
+}
+
+// DiffRevisions returns the differences between the commits from and to
+// name. An empty from compares with an empty tree.
+func (r *Repository) DiffRevisions(from, to string) ([]FileDiff, error) {
+	return r.repo.DiffRevisions(from, to)
+}
+
+// DiffRange returns the differences between rng.From and rng.To, or for a
+// symmetric range between the last commit they share and rng.To.
+func (r *Repository) DiffRange(rng RevisionRange) ([]FileDiff, error) {
+	return r.repo.DiffRange(rng)
+}
+
+// Branches lists all branches, marking the one HEAD points to.
+func (r *Repository) Branches() ([]Branch, error) {
+	names, err := r.repo.ListBranch()
+	if err != nil {
+		return nil, err
+	}
+	current, err := r.repo.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	branches := make([]Branch, 0, len(names))
+	for _, name := range names {
+		branches = append(branches, Branch{Name: name, Current: current != "" && name == current})
+	}
+	return branches, nil
+}
+
+// Migrate upgrades an older repository to the current on-disk format,
+// compressing loose objects. It returns the number of objects rewritten.
+func (r *Repository) Migrate() (int, error) {
+	return r.repo.MigrateObjects()
+}
+
+// GC packs all reachable objects into a single delta-compressed pack.
+func (r *Repository) GC() (*GCResult, error) {
+	return r.repo.GarbageCollect()
+}
+
+// Prune deletes unreachable loose objects older than expire, e.g.
+// "2.weeks.ago" or "now". An empty expire uses gc.pruneExpire from the
+// repository config. With dryRun set nothing is deleted.
+func (r *Repository) Prune(expire string, dryRun bool) ([]PrunedObject, error) {
+	cutoff, err := r.repo.PruneCutoff(expire, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.Prune(cutoff, dryRun)
+}
+
+// Fsck verifies the integrity of every object and ref.
+func (r *Repository) Fsck() (*FsckReport, error) {
+	return r.repo.Fsck()
+}
+
+// CurrentBranch returns the name of the branch HEAD points to, or "" when
+// HEAD is detached.
+func (r *Repository) CurrentBranch() (string, error) {
+	return r.repo.CurrentBranch()
+}
+
+// Head describes what HEAD points to.
+type Head struct {
+	Branch string // Empty when HEAD is detached
+	Commit string // Empty before the first commit
+}
+
+// Detached reports whether HEAD points straight at a commit.
+func (h *Head) Detached() bool {
+	return h.Branch == ""
+}
+
+// Head returns the current branch and commit.
+func (r *Repository) Head() (*Head, error) {
+	branch, err := r.repo.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.repo.HeadCommit()
+	if err != nil {
+		return nil, err
+	}
+	return &Head{Branch: branch, Commit: commit}, nil
+}
+
+// Checkout switches to branch, updating the working directory and index. If
+// create is true a new branch is created at the current commit instead.
+func (r *Repository) Checkout(branch string, create bool) error {
+	_, err := r.Switch(branch, SwitchOptions{Create: create})
+	return err
+}
+
+// SwitchOptions controls Repository.Switch.
+type SwitchOptions struct {
+	Create bool // Create target as a new branch at the current commit
+	Detach bool // Check out the commit target names with a detached HEAD
+}
+
+// Switch moves HEAD to the branch target, or with opts.Detach to the commit
+// target names (any revision, see ResolveRevision), updating the working directory and
+// index. When HEAD was detached, it returns the commits no branch or tag
+// reaches anymore, newest first; they can only be found by their hash.
+func (r *Repository) Switch(target string, opts SwitchOptions) ([]*Commit, error) {
+	if opts.Detach {
+		return r.repo.DetachHead(target)
+	}
+	return r.repo.SwitchBranch(target, opts.Create)
+}
+
+// IgnoreMatch is the ignore pattern deciding whether a path is ignored.
+type IgnoreMatch = core.IgnoreMatch
+
+// CheckIgnore returns the pattern in .gvcignore, .gvc/info/exclude or the
+// global excludes file that decides whether path is ignored, or nil if none
+// matches. Tracked files are never ignored. Relative paths are resolved
+// against the work tree.
+func (r *Repository) CheckIgnore(path string) (*IgnoreMatch, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.repo.WorkTree, path)
+	}
+	return r.repo.CheckIgnore(path)
+}
+
+// CleanOptions controls Repository.Clean.
+type CleanOptions struct {
+	Ignored bool // Also delete files matching an ignore pattern
+	DryRun  bool // Only report what would be deleted
+}
+
+// Clean deletes untracked files from the working directory and returns
+// their paths.
+func (r *Repository) Clean(opts CleanOptions) ([]string, error) {
+	return r.repo.Clean(opts.Ignored, opts.DryRun)
+}
+
+// Tag is a lightweight or annotated tag.
+type Tag = core.Tag
+
+// TagOptions controls Repository.CreateTag.
+type TagOptions struct {
+	Message string // Creates an annotated tag object when set
+	Tagger  string // Recorded in annotated tags
+	Force   bool   // Replace an existing tag of the same name
+}
+
+// CreateTag tags the commit target names (HEAD if empty) as name, under
+// refs/tags. It is lightweight unless opts has a message.
+func (r *Repository) CreateTag(name, target string, opts TagOptions) (*Tag, error) {
+	return r.repo.CreateTag(name, target, opts.Message, opts.Tagger, opts.Force)
+}
+
+// DeleteTag deletes a tag and returns the hash it pointed to.
+func (r *Repository) DeleteTag(name string) (string, error) {
+	return r.repo.DeleteTag(name)
+}
+
+// TagListOptions controls Repository.Tags.
+type TagListOptions struct {
+	Patterns []string // Shell patterns such as "v1.*"; all tags if empty
+	Sort     string   // "refname" (default) or "version:refname", "-" prefixed to reverse
+}
+
+// Tags lists the tags matching opts.Patterns.
+func (r *Repository) Tags(opts TagListOptions) ([]Tag, error) {
+	return r.repo.ListTags(opts.Patterns, opts.Sort)
+}
+
+// ContinueCheckout finishes a checkout that was interrupted, e.g. by a crash.
+func (r *Repository) ContinueCheckout() error {
+	return r.repo.RecoverCheckout(true)
+}
+
+// AbortCheckout undoes a checkout that was interrupted, restoring the files,
+// index and HEAD from before it started.
+func (r *Repository) AbortCheckout() error {
+	return r.repo.RecoverCheckout(false)
+}
+
+// RunFSMonitor watches the work tree and answers the queries of Status, Diff
+// and switching branches until StopFSMonitor is called or it was not queried
+// for idle (DefaultFSMonitorIdle if 0). Scans only use it with core.fsmonitor
+// set to true in .gvc/config, and then start it on their own.
+func (r *Repository) RunFSMonitor(idle time.Duration) error {
+	return r.repo.RunFSMonitor(idle)
+}
+
+// DefaultFSMonitorIdle is how long the fsmonitor daemon runs without queries.
+const DefaultFSMonitorIdle = core.DefaultFSMonitorIdle
+
+// StartFSMonitor starts the fsmonitor daemon in the background, running the
+// gvc executable, and waits until it answers.
+func (r *Repository) StartFSMonitor() error {
+	return r.repo.StartFSMonitor()
+}
+
+// StopFSMonitor asks the fsmonitor daemon to exit.
+func (r *Repository) StopFSMonitor() error {
+	return r.repo.StopFSMonitor()
+}
+
+// FSMonitorRunning reports whether the fsmonitor daemon watches the repository.
+func (r *Repository) FSMonitorRunning() bool {
+	return r.repo.FSMonitorRunning()
+}
+
+// LFSPointer identifies a file in the large file store by its SHA-256.
+type LFSPointer = core.LFSPointer
+
+// LFSFile is a staged file stored in the large file store.
+type LFSFile = core.LFSFile
+
+// LFSTrack stores files matching patterns in the large file store from the
+// next add on, recording the patterns in .gvcattributes. It returns the
+// patterns that were not tracked yet.
+func (r *Repository) LFSTrack(patterns ...string) ([]string, error) {
+	return r.repo.LFSTrack(patterns)
+}
+
+// LFSPatterns returns the patterns of files stored in the large file store.
+func (r *Repository) LFSPatterns() ([]string, error) {
+	return r.repo.LFSPatterns()
+}
+
+// LFSFiles returns the staged files that are stored as LFS pointers.
+func (r *Repository) LFSFiles() ([]LFSFile, error) {
+	return r.repo.LFSFiles()
+}
+
+// LFSPrune deletes large files no commit or index entry refers to. With dryRun
+// set it only reports them.
+func (r *Repository) LFSPrune(dryRun bool) ([]LFSPointer, error) {
+	return r.repo.LFSPrune(dryRun)
+}